@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
 
 	"github.com/HelloAnner/markdown-sync-confluence/pkg/config"
 	"github.com/HelloAnner/markdown-sync-confluence/pkg/markdown"
@@ -35,10 +36,66 @@ Examples:
 
   # Specifying page title
   md2kms test.md --title "My Document" --parent 123456
+
+  # Setting template variables used as {{ .Vars.host }}
+  md2kms runbook.md --parent 123456 --var host=prod.example.com --var region=eu
+
+  # Rendering offline without credentials (storage XML or HTML preview)
+  md2kms render test.md -o test.xml
+  md2kms render test.md --preview -o test.html
+
+  # Listing, then removing, attachments that earlier versions left on a parent page
+  md2kms clean-attachments --parent 123456
+  md2kms clean-attachments --parent 123456 --force
+`
+
+	renderEpilog = `
+Renders the markdown file offline: no credentials are needed and nothing is uploaded.
+Local images are referenced as attachments in the storage output and inlined in the preview.
+
+Examples:
+  md2kms render test.md
+  md2kms render test.md --config config.yml -o test.xml
+  md2kms render test.md --preview -o test.html
+`
+
+	cleanEpilog = `
+Removes attachments that earlier versions uploaded to the parent page while creating new pages.
+Only attachments uploaded by this tool are considered; those still referenced by the parent
+page or its child pages are kept. Without --force the attachments are only listed.
+
+Examples:
+  md2kms clean-attachments --parent 123456
+  md2kms clean-attachments --parent 123456 --config config.yml --force
 `
 )
 
+// varFlags collects repeated --var name=value flags
+type varFlags map[string]string
+
+func (v varFlags) String() string {
+	return ""
+}
+
+func (v varFlags) Set(value string) error {
+	name, val, ok := strings.Cut(value, "=")
+	if !ok || name == "" {
+		return fmt.Errorf("expected name=value, got %q", value)
+	}
+	v[name] = val
+	return nil
+}
+
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "render" {
+		runRender(os.Args[2:])
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "clean-attachments" {
+		runCleanAttachments(os.Args[2:])
+		return
+	}
+
 	// Define command line flags
 	markdownFile := flag.String("file", "", "Path to the markdown file to publish")
 	titleFlag := flag.String("title", "", "Confluence page title (defaults to file name)")
@@ -50,6 +107,10 @@ func main() {
 	usernameFlag := flag.String("username", "", "Confluence username/email")
 	passwordFlag := flag.String("password", "", "Confluence API Token")
 	spaceFlag := flag.String("space", "", "Confluence Space Key")
+
+	// Template variables
+	templateVars := varFlags{}
+	flag.Var(templateVars, "var", "Template variable as name=value (repeatable)")
 	
 	// Add aliases for flags
 	flag.StringVar(titleFlag, "t", "", "Short for --title")
@@ -61,7 +122,7 @@ func main() {
 		fmt.Fprintf(os.Stderr, "Usage: %s [options] markdown_file\n", os.Args[0])
 		fmt.Fprintln(os.Stderr, "Options:")
 		flag.PrintDefaults()
-		fmt.Fprintln(os.Stderr, helpEpilog)
+		fmt.Fprint(os.Stderr, helpEpilog)
 	}
 
 	flag.Parse()
@@ -84,6 +145,10 @@ func main() {
 		"username": *usernameFlag,
 		"password": *passwordFlag,
 		"space":    *spaceFlag,
+		"config":   *configFlag,
+	}
+	for name, value := range templateVars {
+		cliConfig[config.TemplateCLIPrefix+name] = value
 	}
 
 	// Load configuration with priority handling
@@ -111,3 +176,133 @@ func main() {
 		os.Exit(1)
 	}
 }
+
+// runRender converts a markdown file offline and writes the storage format or an HTML preview
+func runRender(arguments []string) {
+	flags := flag.NewFlagSet("render", flag.ExitOnError)
+	outputFlag := flags.String("output", "", "Write the result to a file instead of stdout")
+	previewFlag := flags.Bool("preview", false, "Produce a standalone HTML preview instead of storage XML")
+	titleFlag := flags.String("title", "", "Preview page title (defaults to file name)")
+	configFlag := flags.String("config", "", "Path to config file")
+	templateVars := varFlags{}
+	flags.Var(templateVars, "var", "Template variable as name=value (repeatable)")
+	flags.StringVar(outputFlag, "o", "", "Short for --output")
+	flags.StringVar(titleFlag, "t", "", "Short for --title")
+	flags.StringVar(configFlag, "c", "", "Short for --config")
+
+	flags.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s render [options] markdown_file\n", os.Args[0])
+		fmt.Fprintln(os.Stderr, "Options:")
+		flags.PrintDefaults()
+		fmt.Fprint(os.Stderr, renderEpilog)
+	}
+
+	// Allow options after the file name
+	var markdownFile string
+	for len(arguments) > 0 {
+		flags.Parse(arguments)
+		arguments = flags.Args()
+		if len(arguments) > 0 {
+			if markdownFile == "" {
+				markdownFile = arguments[0]
+			}
+			arguments = arguments[1:]
+		}
+	}
+
+	if markdownFile == "" {
+		fmt.Fprintln(os.Stderr, "❌ Error: Markdown file path is required")
+		flags.Usage()
+		os.Exit(1)
+	}
+
+	cliConfig := map[string]string{"config": *configFlag}
+	for name, value := range templateVars {
+		cliConfig[config.TemplateCLIPrefix+name] = value
+	}
+
+	cfg, err := config.LoadOfflineConfig(cliConfig)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "❌ Error: %s\n", err)
+		os.Exit(1)
+	}
+
+	// Progress and warning messages go to stderr so stdout only carries the result
+	converter := markdown.NewConverter(cfg)
+	converter.SetOutput(os.Stderr)
+	var result string
+	if *previewFlag {
+		title := *titleFlag
+		if title == "" {
+			title = filepath.Base(markdownFile)
+			title = title[0 : len(title)-len(filepath.Ext(title))]
+		}
+		result, err = converter.PreviewFile(markdownFile, title)
+	} else {
+		result, err = converter.RenderFile(markdownFile)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "❌ Error: %s\n", err)
+		os.Exit(1)
+	}
+
+	if *outputFlag == "" {
+		fmt.Fprintln(os.Stdout, result)
+		return
+	}
+	if err := os.WriteFile(*outputFlag, []byte(result), 0644); err != nil {
+		fmt.Fprintf(os.Stderr, "❌ Error: %s\n", err)
+		os.Exit(1)
+	}
+	fmt.Fprintf(os.Stderr, "✅ Written to %s\n", *outputFlag)
+}
+
+// runCleanAttachments removes attachments left on a parent page by earlier versions
+func runCleanAttachments(arguments []string) {
+	flags := flag.NewFlagSet("clean-attachments", flag.ExitOnError)
+	parentFlag := flags.String("parent", "", "Parent page ID")
+	forceFlag := flags.Bool("force", false, "Delete the attachments instead of only listing them")
+	configFlag := flags.String("config", "", "Path to config file")
+	urlFlag := flags.String("url", "", "Confluence URL (e.g. https://your-domain.atlassian.net)")
+	usernameFlag := flags.String("username", "", "Confluence username/email")
+	passwordFlag := flags.String("password", "", "Confluence API Token")
+	spaceFlag := flags.String("space", "", "Confluence Space Key")
+	flags.StringVar(parentFlag, "p", "", "Short for --parent")
+	flags.StringVar(configFlag, "c", "", "Short for --config")
+
+	flags.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s clean-attachments [options]\n", os.Args[0])
+		fmt.Fprintln(os.Stderr, "Options:")
+		flags.PrintDefaults()
+		fmt.Fprint(os.Stderr, cleanEpilog)
+	}
+	flags.Parse(arguments)
+
+	cfg, err := config.LoadConfig(map[string]string{
+		"url":      *urlFlag,
+		"username": *usernameFlag,
+		"password": *passwordFlag,
+		"space":    *spaceFlag,
+		"config":   *configFlag,
+	})
+	if err != nil {
+		fmt.Printf("❌ Error: %s\n", err)
+		os.Exit(1)
+	}
+
+	converter := markdown.NewConverter(cfg)
+	removed, err := converter.CleanParentAttachments(*parentFlag, !*forceFlag)
+	if err != nil {
+		fmt.Printf("❌ Error: %s\n", err)
+		os.Exit(1)
+	}
+
+	switch {
+	case len(removed) == 0:
+		fmt.Println("✅ No leftover attachments found")
+	case !*forceFlag:
+		fmt.Printf("ℹ️ %d attachment(s) would be removed; run with --force to delete them\n", len(removed))
+	default:
+		fmt.Printf("✅ Removed %d attachment(s)\n", len(removed))
+	}
+}
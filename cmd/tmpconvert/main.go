@@ -21,7 +21,7 @@ func main() {
     if err := json.NewDecoder(os.Stdin).Decode(&resp); err != nil {
         panic(err)
     }
-    handler := confluence.NewContentHandler()
+    handler := confluence.NewContentHandler(nil)
     md, err := handler.ConvertToMarkdown(resp.Body.Storage.Value)
     if err != nil {
         panic(err)
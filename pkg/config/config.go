@@ -3,6 +3,7 @@ package config
 import (
 	"fmt"
 	"os"
+	"path/filepath"
 	"strings"
 
 	"gopkg.in/yaml.v3"
@@ -11,6 +12,7 @@ import (
 // Config 配置
 type Config struct {
 	Confluence ConfluenceConfig `yaml:"confluence"`
+	Markdown   MarkdownConfig   `yaml:"markdown"`
 }
 
 // ConfluenceConfig confluence 配置
@@ -22,25 +24,294 @@ type ConfluenceConfig struct {
 	ParentPageID string `yaml:"parent_page_id,omitempty"`
 }
 
+// MarkdownConfig Markdown 转换配置
+type MarkdownConfig struct {
+	CodeMacros  []CodeMacroConfig `yaml:"code_macros,omitempty"`
+	CodeBlock   CodeBlockConfig   `yaml:"code_block,omitempty"`
+	Math        MathConfig        `yaml:"math,omitempty"`
+	TOC         TOCConfig         `yaml:"toc,omitempty"`
+	Footnotes   FootnotesConfig   `yaml:"footnotes,omitempty"`
+	Mentions    MentionsConfig    `yaml:"mentions,omitempty"`
+	Emoji       EmojiConfig       `yaml:"emoji,omitempty"`
+	Jira        JiraConfig        `yaml:"jira,omitempty"`
+	Template    TemplateConfig    `yaml:"template,omitempty"`
+	Pipeline    PipelineConfig    `yaml:"pipeline,omitempty"`
+	Images      ImagesConfig      `yaml:"images,omitempty"`
+	Attachments AttachmentsConfig `yaml:"attachments,omitempty"`
+	Obsidian    ObsidianConfig    `yaml:"obsidian,omitempty"`
+}
+
+// ObsidianConfig Obsidian 兼容模式配置
+// 启用后 ![[name]] 在整个仓库中按文件名查找，支持 [[笔记]] 链接、callout、%%注释%% 与 #标签
+type ObsidianConfig struct {
+	Enabled bool   `yaml:"enabled,omitempty"`
+	Vault   string `yaml:"vault,omitempty"` // 仓库根目录，为空时向上查找包含 .obsidian 的目录，找不到时使用Markdown文件所在目录
+}
+
+// AttachmentsConfig 链接到的本地文件的附件配置
+type AttachmentsConfig struct {
+	Enabled  bool `yaml:"enabled,omitempty"`   // 上传链接到的本地文件（限Markdown文件所在目录内），默认保留原链接
+	ViewFile bool `yaml:"view_file,omitempty"` // PDF与Office文件以 view-file 宏嵌入预览
+}
+
+// ImagesConfig 图片尺寸配置
+// 显示尺寸按 max_width/max_height 等比缩小，但不小于原尺寸的 min_scale 倍
+type ImagesConfig struct {
+	MaxWidth     int     `yaml:"max_width,omitempty"`     // 最大显示宽度，默认600
+	MaxHeight    int     `yaml:"max_height,omitempty"`    // 最大显示高度，默认400
+	MinScale     float64 `yaml:"min_scale,omitempty"`     // 最小缩放比例，默认0.6
+	Resize       bool    `yaml:"resize,omitempty"`        // 上传前缩小并重新压缩超出 resize_width/resize_height 的PNG/JPEG图片
+	ResizeWidth  int     `yaml:"resize_width,omitempty"`  // 上传图片的最大像素宽度，默认1600
+	ResizeHeight int     `yaml:"resize_height,omitempty"` // 上传图片的最大像素高度，默认1600
+	Quality      int     `yaml:"quality,omitempty"`       // 重新压缩JPEG的质量（1-100），默认85
+	Rehost       bool    `yaml:"rehost,omitempty"`        // 下载外部图片并上传为页面附件
+	MaxSizeMB    int     `yaml:"max_size_mb,omitempty"`   // 下载的外部图片与data URI图片的大小上限（MB），默认10
+	Cache        string  `yaml:"cache,omitempty"`         // 附件缓存文件，默认位于用户缓存目录，设为 off 关闭
+}
+
+// ImagesCacheOff 关闭附件缓存
+const ImagesCacheOff = "off"
+
+// Resolved 返回填充默认值后的图片配置
+func (i ImagesConfig) Resolved() ImagesConfig {
+	if i.MaxWidth <= 0 {
+		i.MaxWidth = 600
+	}
+	if i.MaxHeight <= 0 {
+		i.MaxHeight = 400
+	}
+	if i.MinScale <= 0 || i.MinScale > 1 {
+		i.MinScale = 0.6
+	}
+	if i.ResizeWidth <= 0 {
+		i.ResizeWidth = 1600
+	}
+	if i.ResizeHeight <= 0 {
+		i.ResizeHeight = 1600
+	}
+	if i.Quality <= 0 || i.Quality > 100 {
+		i.Quality = 85
+	}
+	if i.MaxSizeMB <= 0 {
+		i.MaxSizeMB = 10
+	}
+	if i.Cache == "" {
+		if dir, err := os.UserCacheDir(); err == nil {
+			i.Cache = filepath.Join(dir, "md2kms", "attachments.json")
+		} else {
+			i.Cache = ImagesCacheOff
+		}
+	}
+	return i
+}
+
+// PipelineConfig 转换流水线配置，按名称禁用步骤或调整执行顺序
+type PipelineConfig struct {
+	Disabled []string       `yaml:"disabled,omitempty"`
+	Order    map[string]int `yaml:"order,omitempty"`
+}
+
+// 模板变量的环境变量与命令行参数前缀
+const (
+	TemplateEnvPrefix = "KMS_VAR_"
+	TemplateCLIPrefix = "var."
+)
+
+// TemplateConfig 模板变量配置，{{ .Vars.name }} 在发布前替换为变量值
+// 变量优先级（从高到低）：命令行 --var、环境变量 KMS_VAR_*、配置文件、front matter 中的 vars
+type TemplateConfig struct {
+	Vars       map[string]string `yaml:"vars,omitempty"`
+	Strict     bool              `yaml:"strict,omitempty"`      // 存在未定义变量时报错
+	CodeBlocks bool              `yaml:"code_blocks,omitempty"` // 同时替换代码块中的变量
+}
+
+// Jira 引用语法
+const (
+	JiraSyntaxKey  = "key"  // 裸问题编号 PROJ-123（默认）
+	JiraSyntaxWiki = "wiki" // [[jira:PROJ-123]]
+)
+
+// JiraConfig Jira 问题引用配置，启用后 [[jira:PROJ-123]] 与匹配项目的裸问题编号发布为 jira 宏
+type JiraConfig struct {
+	Enabled  bool     `yaml:"enabled,omitempty"`
+	Server   string   `yaml:"server,omitempty"`    // Jira 应用链接名称
+	ServerID string   `yaml:"server_id,omitempty"` // Jira 应用链接 ID
+	Projects []string `yaml:"projects,omitempty"`  // 项目键正则，如 PROJ 或 [A-Z]{2,}，为空时不转换裸问题编号
+	Syntax   string   `yaml:"syntax,omitempty"`    // 下载时使用的语法：key 或 wiki
+}
+
+// MentionsConfig @提及语法配置
+type MentionsConfig struct {
+	Disabled bool   `yaml:"disabled,omitempty"`
+	Prefix   string `yaml:"prefix,omitempty"` // 提及前缀，默认 @
+	Suffix   string `yaml:"suffix,omitempty"` // 提及后缀，设置后用户名可包含空格，如 @{张 三}
+}
+
+// Resolved 返回填充默认值后的提及配置
+func (m MentionsConfig) Resolved() MentionsConfig {
+	if m.Prefix == "" {
+		m.Prefix = "@"
+	}
+	return m
+}
+
+// EmojiConfig 表情短代码配置
+type EmojiConfig struct {
+	Disabled bool `yaml:"disabled,omitempty"` // 关闭 :smile: 到 Confluence 表情的转换
+}
+
+// FootnotesConfig 脚注配置
+type FootnotesConfig struct {
+	Title string `yaml:"title,omitempty"` // 脚注区标题，默认 Notes
+}
+
+// 目录宏插入模式
+const (
+	TOCModeAuto   = "auto"   // 标题数达到阈值时插入到页首
+	TOCModeAlways = "always" // 总是插入到页首（默认）
+	TOCModeOff    = "off"    // 不插入，[TOC] 标记也会被移除
+)
+
+// TOCConfig 目录宏配置，文档中的 [TOC] / [[toc]] 标记优先决定插入位置
+type TOCConfig struct {
+	Mode        string `yaml:"mode,omitempty"`
+	MinHeadings int    `yaml:"min_headings,omitempty"` // auto 模式下的标题数阈值，默认 3
+	MinLevel    int    `yaml:"min_level,omitempty"`    // 默认 1
+	MaxLevel    int    `yaml:"max_level,omitempty"`    // 默认 3
+	Style       string `yaml:"style,omitempty"`        // 默认 disc
+}
+
+// Resolved 返回填充默认值后的目录配置
+func (t TOCConfig) Resolved() TOCConfig {
+	if t.Mode == "" {
+		t.Mode = TOCModeAlways
+	}
+	if t.MinHeadings <= 0 {
+		t.MinHeadings = 3
+	}
+	if t.MinLevel <= 0 {
+		t.MinLevel = 1
+	}
+	if t.MaxLevel <= 0 {
+		t.MaxLevel = 3
+	}
+	if t.Style == "" {
+		t.Style = "disc"
+	}
+	return t
+}
+
+// MathConfig LaTeX 公式配置
+type MathConfig struct {
+	Disabled        bool   `yaml:"disabled,omitempty"`         // 关闭 $...$ / $$...$$ 解析
+	InlineMacro     string `yaml:"inline_macro,omitempty"`     // 行内公式宏，默认 mathinline
+	InlineParameter string `yaml:"inline_parameter,omitempty"` // 行内公式所在参数，默认 body
+	InlineAsBody    bool   `yaml:"inline_as_body,omitempty"`   // 行内公式放入 ac:plain-text-body 而非参数
+	BlockMacro      string `yaml:"block_macro,omitempty"`      // 块级公式宏，默认 mathblock
+}
+
+// Resolved 返回填充默认值后的公式配置
+func (m MathConfig) Resolved() MathConfig {
+	if m.InlineMacro == "" {
+		m.InlineMacro = "mathinline"
+	}
+	if m.InlineParameter == "" {
+		m.InlineParameter = "body"
+	}
+	if m.BlockMacro == "" {
+		m.BlockMacro = "mathblock"
+	}
+	return m
+}
+
+// CodeBlockConfig 代码宏的默认选项
+type CodeBlockConfig struct {
+	Theme            string            `yaml:"theme,omitempty"`             // 默认主题，如 Midnight、RDark
+	LineNumbers      bool              `yaml:"line_numbers,omitempty"`      // 默认显示行号
+	FallbackLanguage string            `yaml:"fallback_language,omitempty"` // 不支持的语言回退值，默认 text
+	LanguageAliases  map[string]string `yaml:"language_aliases,omitempty"`  // 额外的语言别名，如 go: go
+}
+
+// 代码块宏的正文形式
+const (
+	CodeMacroBodyPlain  = "plain"  // 代码放入 ac:plain-text-body
+	CodeMacroBodyFenced = "fenced" // 连同 ``` 围栏一起放入 ac:plain-text-body
+	CodeMacroBodyNone   = "none"   // 无正文，代码中的 key=value 行作为宏参数
+)
+
+// CodeMacroConfig 代码块语言到 Confluence 宏的映射
+type CodeMacroConfig struct {
+	Language   string            `yaml:"language"`
+	Macro      string            `yaml:"macro"`
+	Body       string            `yaml:"body,omitempty"`
+	Parameters map[string]string `yaml:"parameters,omitempty"`
+}
+
+// defaultCodeMacros 内置的代码块宏映射
+var defaultCodeMacros = []CodeMacroConfig{
+	{Language: "mermaid", Macro: "markdown", Body: CodeMacroBodyFenced},
+}
+
+// ResolvedCodeMacros 返回生效的代码块宏映射，用户配置覆盖同语言的内置映射
+func (m MarkdownConfig) ResolvedCodeMacros() []CodeMacroConfig {
+	var result []CodeMacroConfig
+	seen := make(map[string]bool)
+
+	for _, macro := range append(append([]CodeMacroConfig{}, m.CodeMacros...), defaultCodeMacros...) {
+		language := strings.ToLower(strings.TrimSpace(macro.Language))
+		if language == "" || macro.Macro == "" || seen[language] {
+			continue
+		}
+		seen[language] = true
+
+		macro.Language = language
+		if macro.Body == "" {
+			macro.Body = CodeMacroBodyPlain
+		}
+		result = append(result, macro)
+	}
+
+	return result
+}
+
 // LoadConfig  按照优先级加载配置
 // 1. 最高优先级: 命令行参数
 // 2. 次高优先级: 环境变量
+// 3. 最低优先级: 配置文件 (cliArgs["config"])
 func LoadConfig(cliArgs map[string]string) (*Config, error) {
+	config, err := LoadOfflineConfig(cliArgs)
+	if err != nil {
+		return nil, err
+	}
+
+	// 验证必填配置
+	if err := validateConfig(config); err != nil {
+		return nil, err
+	}
+
+	return config, nil
+}
+
+// LoadOfflineConfig 按照与 LoadConfig 相同的优先级加载配置，但不要求Confluence连接信息
+// 用于离线渲染等不访问Confluence的场景
+func LoadOfflineConfig(cliArgs map[string]string) (*Config, error) {
 	config := &Config {
 		Confluence: ConfluenceConfig{},
 	}
 
+	// 0. 从配置文件加载 (最低优先级)
+	if configPath := cliArgs["config"]; configPath != "" {
+		if err := loadFromFile(configPath, config); err != nil {
+			return nil, fmt.Errorf("failed to load config file %s: %w", configPath, err)
+		}
+	}
+
 	// 1. 从环境变量加载 (次高优先级)
 	loadFromEnv(config)
 
 	// 2. 从命令行参数加载 (最高优先级)
 	loadFromCLI(config, cliArgs)
 
-	// 验证必填配置
-	if err := validateConfig(config); err != nil {
-		return nil, err
-	}
-
 	return config, nil
 }
 
@@ -71,6 +342,12 @@ func loadFromEnv(config *Config) {
 	if space := os.Getenv("KMS_SPACE"); space != "" {
 		config.Confluence.Space = space
 	}
+
+	for _, env := range os.Environ() {
+		if name, value, ok := strings.Cut(env, "="); ok && strings.HasPrefix(name, TemplateEnvPrefix) {
+			setTemplateVar(config, strings.TrimPrefix(name, TemplateEnvPrefix), value)
+		}
+	}
 }
 
 // loadFromCLI 从命令行参数加载配置
@@ -90,6 +367,23 @@ func loadFromCLI(config *Config, cliArgs map[string]string) {
 	if space := cliArgs["space"]; space != "" {
 		config.Confluence.Space = space
 	}
+
+	for key, value := range cliArgs {
+		if strings.HasPrefix(key, TemplateCLIPrefix) {
+			setTemplateVar(config, strings.TrimPrefix(key, TemplateCLIPrefix), value)
+		}
+	}
+}
+
+// setTemplateVar 设置模板变量
+func setTemplateVar(config *Config, name, value string) {
+	if name == "" {
+		return
+	}
+	if config.Markdown.Template.Vars == nil {
+		config.Markdown.Template.Vars = make(map[string]string)
+	}
+	config.Markdown.Template.Vars[name] = value
 }
 
 // validateConfig 验证配置
@@ -119,7 +413,8 @@ func validateConfig(config *Config) error {
 			"   --url, --username, --password, --space\n"+
 			"2. Environment variables:\n"+
 			"   KMS_URL, KMS_USERNAME, KMS_PASSWORD, KMS_SPACE\n"+
-			"3. Configuration file", strings.Join(missingKeys, ", "))
+			"3. Configuration file:\n"+
+			"   --config config.yml", strings.Join(missingKeys, ", "))
 	}
 
 	return nil
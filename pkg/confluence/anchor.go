@@ -0,0 +1,33 @@
+package confluence
+
+import (
+	"strings"
+	"unicode"
+)
+
+// HeadingAnchor 返回 Confluence 为标题生成的锚点名称
+// Confluence 以去除所有空白后的标题文本作为锚点（保留大小写与中文等字符），
+// ac:link 的 ac:anchor 使用该名称即可跳转到对应标题
+func HeadingAnchor(text string) string {
+	return strings.Map(func(r rune) rune {
+		if unicode.IsSpace(r) {
+			return -1
+		}
+		return r
+	}, strings.TrimSpace(text))
+}
+
+// HeadingSlug 返回 GitHub 风格的标题锚点，Markdown 中的 [text](#slug) 通常使用该格式
+// 规则: 转为小写，去除字母、数字、空格、- 和 _ 以外的字符，空格替换为 -；中文等字符保留
+func HeadingSlug(text string) string {
+	var sb strings.Builder
+	for _, r := range strings.ToLower(strings.TrimSpace(text)) {
+		switch {
+		case unicode.IsLetter(r) || unicode.IsNumber(r) || r == '-' || r == '_':
+			sb.WriteRune(r)
+		case unicode.IsSpace(r):
+			sb.WriteRune('-')
+		}
+	}
+	return sb.String()
+}
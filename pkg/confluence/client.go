@@ -64,6 +64,29 @@ type SpaceInfo struct {
 	Type  string `json:"type"`
 }
 
+// User 表示一个 Confluence 用户
+type User struct {
+	Type        string `json:"type"`
+	Username    string `json:"username"`  // Server/Data Center
+	UserKey     string `json:"userKey"`   // Server/Data Center
+	AccountID   string `json:"accountId"` // Cloud
+	DisplayName string `json:"displayName"`
+}
+
+// Attachment 表示页面上的一个附件
+type Attachment struct {
+	ID       string `json:"id"`
+	Title    string `json:"title"`
+	Metadata struct {
+		Comment   string `json:"comment"`
+		MediaType string `json:"mediaType"`
+	} `json:"metadata"`
+	Version VersionInfo `json:"version"`
+}
+
+// DefaultAttachmentComment 上传附件时的默认备注
+const DefaultAttachmentComment = "Uploaded by markdown-sync-confluence"
+
 // SearchOptions 定义搜索选项
 type SearchOptions struct {
 	SpaceKey string // 限定搜索的空间
@@ -82,6 +105,28 @@ func NewClient(config *config.Config) *Client {
 
 // FindPageInParent 在父页面中查找一个页面
 func (c *Client) FindPageInParent(title, parentPageID string) (*Page, error) {
+	pages, err := c.ListChildPages(parentPageID)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, page := range pages {
+		if page.Title == title {
+			return &page, nil
+		}
+	}
+
+	return nil, nil
+}
+
+// ListChildPages 列出父页面的所有直接子页面
+// 参数:
+//   - parentPageID: 父页面ID
+// 返回:
+//   - []Page: 子页面列表
+//   - error: 错误信息
+func (c *Client) ListChildPages(parentPageID string) ([]Page, error) {
+	var pages []Page
 	start := 0
 	limit := 100 // 每页获取100个结果
 	
@@ -101,10 +146,10 @@ func (c *Client) FindPageInParent(title, parentPageID string) (*Page, error) {
 		if err != nil {
 			return nil, err
 		}
-		defer resp.Body.Close()
 
 		if resp.StatusCode != http.StatusOK {
 			body, _ := io.ReadAll(resp.Body)
+			resp.Body.Close()
 			return nil, fmt.Errorf("error finding page: %s - %s", resp.Status, string(body))
 		}
 
@@ -118,16 +163,13 @@ func (c *Client) FindPageInParent(title, parentPageID string) (*Page, error) {
 			} `json:"_links"`
 		}
 
-		if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		err = json.NewDecoder(resp.Body).Decode(&result)
+		resp.Body.Close()
+		if err != nil {
 			return nil, err
 		}
 
-		// 在当前页面中查找目标页面
-		for _, page := range result.Results {
-			if page.Title == title {
-				return &page, nil
-			}
-		}
+		pages = append(pages, result.Results...)
 
 		// 如果没有更多结果，退出循环
 		if len(result.Results) < limit || result.Links.Next == "" {
@@ -138,6 +180,46 @@ func (c *Client) FindPageInParent(title, parentPageID string) (*Page, error) {
 		start += limit
 	}
 
+	return pages, nil
+}
+
+// GetUser 按用户名、用户 key 或 account ID 查找用户，未找到时返回 nil
+func (c *Client) GetUser(identifier string) (*User, error) {
+	for _, param := range []string{"username", "key", "accountId"} {
+		endpoint := fmt.Sprintf("%s/rest/api/user?%s=%s", c.config.Confluence.URL, param, url.QueryEscape(identifier))
+
+		req, err := http.NewRequest("GET", endpoint, nil)
+		if err != nil {
+			return nil, err
+		}
+
+		req.SetBasicAuth(c.config.Confluence.Username, c.config.Confluence.Password)
+		req.Header.Set("Content-Type", "application/json")
+
+		resp, err := c.httpClient.Do(req)
+		if err != nil {
+			return nil, err
+		}
+
+		if resp.StatusCode == http.StatusOK {
+			var user User
+			err := json.NewDecoder(resp.Body).Decode(&user)
+			resp.Body.Close()
+			if err != nil {
+				return nil, err
+			}
+			return &user, nil
+		}
+
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+
+		// 不同部署支持的查询参数不同，参数无效或用户不存在时尝试下一种
+		if resp.StatusCode != http.StatusNotFound && resp.StatusCode != http.StatusBadRequest {
+			return nil, fmt.Errorf("error getting user: %s - %s", resp.Status, string(body))
+		}
+	}
+
 	return nil, nil
 }
 
@@ -320,9 +402,29 @@ func (c *Client) CreatePage(title, body, parentPageID string) (*Page, error) {
 }
 
 // AttachFile  上传文件到页面
-func (c *Client) AttachFile(pageID, filename string, content []byte, contentType string) (map[string]interface{}, error) {
+// comment 为附件备注，为空时使用默认备注
+func (c *Client) AttachFile(pageID, filename string, content []byte, contentType, comment string) (map[string]interface{}, error) {
 	endpoint := fmt.Sprintf("%s/rest/api/content/%s/child/attachment", c.config.Confluence.URL, pageID)
+	return c.uploadAttachment(endpoint, filename, content, comment)
+}
 
+// UpdateAttachmentData 上传附件的新版本
+// 参数:
+//   - pageID: 附件所在页面ID
+//   - attachmentID: 附件ID
+//   - filename: 文件名
+//   - content: 文件内容
+//   - comment: 附件备注，为空时使用默认备注
+// 返回:
+//   - map[string]interface{}: 更新后的附件信息
+//   - error: 错误信息
+func (c *Client) UpdateAttachmentData(pageID, attachmentID, filename string, content []byte, comment string) (map[string]interface{}, error) {
+	endpoint := fmt.Sprintf("%s/rest/api/content/%s/child/attachment/%s/data", c.config.Confluence.URL, pageID, attachmentID)
+	return c.uploadAttachment(endpoint, filename, content, comment)
+}
+
+// uploadAttachment 以 multipart 表单上传附件内容
+func (c *Client) uploadAttachment(endpoint, filename string, content []byte, comment string) (map[string]interface{}, error) {
 	body := &bytes.Buffer{}
 	writer := multipart.NewWriter(body)
 
@@ -335,7 +437,11 @@ func (c *Client) AttachFile(pageID, filename string, content []byte, contentType
 		return nil, err
 	}
 
-	_ = writer.WriteField("comment", "Uploaded by markdown-sync-confluence")
+	if comment == "" {
+		comment = DefaultAttachmentComment
+	}
+	_ = writer.WriteField("comment", comment)
+	_ = writer.WriteField("minorEdit", "true")
 
 	err = writer.Close()
 	if err != nil {
@@ -348,7 +454,6 @@ func (c *Client) AttachFile(pageID, filename string, content []byte, contentType
 	}
 
 	req.Header.Set("Content-Type", writer.FormDataContentType())
-	req.Header.Set("X-Atlassian-Token", "no-check")
 	req.SetBasicAuth(c.config.Confluence.Username, c.config.Confluence.Password)
 
 	req.Header.Set("X-Atlassian-Token", "nocheck")
@@ -424,6 +529,131 @@ func (c *Client) GetAttachments(pageID string) ([]map[string]interface{}, error)
 	return result.Results, nil
 }
 
+// ListAttachments 获取一个页面的所有附件（含备注），自动翻页
+// 参数:
+//   - pageID: 页面ID
+// 返回:
+//   - []Attachment: 附件列表
+//   - error: 错误信息
+func (c *Client) ListAttachments(pageID string) ([]Attachment, error) {
+	var attachments []Attachment
+	start := 0
+	limit := 100
+
+	for {
+		endpoint := fmt.Sprintf("%s/rest/api/content/%s/child/attachment?expand=metadata,version&limit=%d&start=%d",
+			c.config.Confluence.URL, pageID, limit, start)
+
+		req, err := http.NewRequest("GET", endpoint, nil)
+		if err != nil {
+			return nil, err
+		}
+
+		req.SetBasicAuth(c.config.Confluence.Username, c.config.Confluence.Password)
+		req.Header.Set("Content-Type", "application/json")
+
+		resp, err := c.httpClient.Do(req)
+		if err != nil {
+			return nil, err
+		}
+
+		if resp.StatusCode != http.StatusOK {
+			body, _ := io.ReadAll(resp.Body)
+			resp.Body.Close()
+			return nil, fmt.Errorf("error getting attachments: %s - %s", resp.Status, string(body))
+		}
+
+		var result struct {
+			Results []Attachment `json:"results"`
+			Links   struct {
+				Next string `json:"next"`
+			} `json:"_links"`
+		}
+		err = json.NewDecoder(resp.Body).Decode(&result)
+		resp.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+
+		attachments = append(attachments, result.Results...)
+		if len(result.Results) < limit || result.Links.Next == "" {
+			break
+		}
+		start += limit
+	}
+
+	return attachments, nil
+}
+
+// DeleteAttachment 删除附件（移入回收站）
+// 参数:
+//   - attachmentID: 附件ID
+// 返回:
+//   - error: 错误信息
+func (c *Client) DeleteAttachment(attachmentID string) error {
+	endpoint := fmt.Sprintf("%s/rest/api/content/%s", c.config.Confluence.URL, attachmentID)
+
+	req, err := http.NewRequest("DELETE", endpoint, nil)
+	if err != nil {
+		return err
+	}
+
+	req.SetBasicAuth(c.config.Confluence.Username, c.config.Confluence.Password)
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusNoContent {
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("error deleting attachment: %s - %s", resp.Status, string(body))
+	}
+
+	return nil
+}
+
+// AddLabels 为页面添加标签，已存在的标签保持不变
+// 参数:
+//   - pageID: 页面ID
+//   - labels: 标签名列表
+// 返回:
+//   - error: 错误信息
+func (c *Client) AddLabels(pageID string, labels []string) error {
+	endpoint := fmt.Sprintf("%s/rest/api/content/%s/label", c.config.Confluence.URL, pageID)
+
+	bodyData := make([]map[string]string, 0, len(labels))
+	for _, label := range labels {
+		bodyData = append(bodyData, map[string]string{"prefix": "global", "name": label})
+	}
+	bodyBytes, err := json.Marshal(bodyData)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest("POST", endpoint, bytes.NewBuffer(bodyBytes))
+	if err != nil {
+		return err
+	}
+
+	req.SetBasicAuth(c.config.Confluence.Username, c.config.Confluence.Password)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("error adding labels: %s - %s", resp.Status, string(body))
+	}
+
+	return nil
+}
+
 // SearchPages 使用关键词搜索页面
 // 参数:
 //   - query: 搜索关键词
@@ -16,7 +16,7 @@ type Converter struct {
 
 func NewConverter(config *config.Config) *Converter {
 	confluenceClient := NewClient(config)
-	contentHandler := NewContentHandler()
+	contentHandler := NewContentHandler(config)
 	return &Converter{config: config, confluenceClient: confluenceClient, contentHandler: contentHandler}
 }
 
@@ -2,20 +2,39 @@ package confluence
 
 import (
 	"fmt"
+	"html"
 	"regexp"
+	"sort"
 	"strings"
+
+	"github.com/HelloAnner/markdown-sync-confluence/pkg/config"
 )
 
 // ContentHandler handles the conversion of Confluence HTML content to Markdown
 type ContentHandler struct {
 	// 存储已处理的图片映射
 	processedImages map[string]string
+	// 代码块语言到宏的映射（用于反向转换）
+	codeMacros []config.CodeMacroConfig
+	// 公式宏配置
+	math config.MathConfig
+	// 提及语法配置
+	mentions config.MentionsConfig
+	// Jira 问题引用配置
+	jira config.JiraConfig
 }
 
-// NewContentHandler creates a new ContentHandler instance
-func NewContentHandler() *ContentHandler {
+// NewContentHandler creates a new ContentHandler instance, cfg may be nil
+func NewContentHandler(cfg *config.Config) *ContentHandler {
+	if cfg == nil {
+		cfg = &config.Config{}
+	}
 	return &ContentHandler{
 		processedImages: make(map[string]string),
+		codeMacros:      cfg.Markdown.ResolvedCodeMacros(),
+		math:            cfg.Markdown.Math.Resolved(),
+		mentions:        cfg.Markdown.Mentions.Resolved(),
+		jira:            cfg.Markdown.Jira,
 	}
 }
 
@@ -25,10 +44,17 @@ func (h *ContentHandler) ConvertToMarkdown(content string) (string, error) {
 	content = h.preProcessContent(content)
 
 	// 转换各种元素
+	content = h.convertMath(content)
+	content = h.convertFootnotes(content)
+	content = h.convertAnchorLinks(content)
+	content = h.convertEmojis(content)
+	content = h.convertMentions(content)
+	content = h.convertStatus(content)
+	content = h.convertJiraMacros(content)
+	content = h.convertTables(content)
 	content = h.convertHeadings(content)
 	content = h.convertParagraphs(content)
 	content = h.convertLists(content)
-	content = h.convertTables(content)
 	content = h.convertLinks(content)
 	content = h.convertImages(content)
 	content = h.convertCodeBlocks(content)
@@ -37,9 +63,6 @@ func (h *ContentHandler) ConvertToMarkdown(content string) (string, error) {
 	content = h.convertTaskLists(content)
 	content = h.convertQuotes(content)
 	content = h.convertAttachments(content)
-	content = h.convertEmojis(content)
-	content = h.convertMentions(content)
-	content = h.convertStatus(content)
 
 	// 后处理内容
 	content = h.postProcessContent(content)
@@ -60,6 +83,189 @@ func (h *ContentHandler) preProcessContent(content string) string {
 	return content
 }
 
+// convertMath 将公式宏还原为 $...$ 与 $$...$$，需在段落转换之前执行
+func (h *ContentHandler) convertMath(content string) string {
+	reBlock := regexp.MustCompile(`(?s)<ac:structured-macro[^>]*?ac:name="` + regexp.QuoteMeta(h.math.BlockMacro) + `"[^>]*?>.*?<ac:plain-text-body><!\[CDATA\[(.*?)\]\]></ac:plain-text-body>.*?</ac:structured-macro>`)
+	content = reBlock.ReplaceAllStringFunc(content, func(match string) string {
+		formula := strings.TrimSpace(strings.ReplaceAll(reBlock.FindStringSubmatch(match)[1], "]]&gt;", "]]>"))
+		return "\n$$\n" + formula + "\n$$\n\n"
+	})
+
+	reInline := regexp.MustCompile(`(?s)<ac:structured-macro[^>]*?ac:name="` + regexp.QuoteMeta(h.math.InlineMacro) + `"[^>]*?>(.*?)</ac:structured-macro>`)
+	return reInline.ReplaceAllStringFunc(content, func(match string) string {
+		inner := reInline.FindStringSubmatch(match)[1]
+		formula := ""
+		if m := regexp.MustCompile(`(?s)<ac:plain-text-body><!\[CDATA\[(.*?)\]\]></ac:plain-text-body>`).FindStringSubmatch(inner); m != nil {
+			// 保持实体转义，由后续 cleanHTML 统一解码
+			formula = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;").Replace(m[1])
+		} else if m := regexp.MustCompile(`(?s)<ac:parameter[^>]*?ac:name="` + regexp.QuoteMeta(h.math.InlineParameter) + `"[^>]*?>(.*?)</ac:parameter>`).FindStringSubmatch(inner); m != nil {
+			formula = m[1]
+		}
+		if strings.TrimSpace(formula) == "" {
+			return ""
+		}
+		return "$" + strings.TrimSpace(formula) + "$"
+	})
+}
+
+// convertFootnotes 将发布时生成的脚注引用与 Notes 区还原为 [^1] 语法，需在锚点链接转换之前执行
+func (h *ContentHandler) convertFootnotes(content string) string {
+	reAnchor := `<ac:structured-macro[^>]*?ac:name="anchor"[^>]*?>\s*<ac:parameter[^>]*?>%s</ac:parameter>\s*</ac:structured-macro>`
+
+	// 脚注引用
+	reRef := regexp.MustCompile(`(?s)<sup>(?:` + fmt.Sprintf(reAnchor, `fnref-[\d-]+`) + `)?<ac:link[^>]*?ac:anchor="fn-(\d+)"[^>]*?>.*?</ac:link></sup>`)
+	content = reRef.ReplaceAllString(content, "[^$1]")
+
+	// Notes 区，脚注内可以包含嵌套列表，按标签配对查找
+	reHeader := regexp.MustCompile(`(?s)<hr\s*/?>\s*<p><strong>[^<]*</strong></p>\s*$`)
+	reItemAnchor := regexp.MustCompile(fmt.Sprintf(reAnchor, `fn-(\d+)`))
+	var result strings.Builder
+	last := 0
+	for _, list := range outerElements(content, "ol") {
+		items := content[list[1]:list[2]]
+		if !reItemAnchor.MatchString(items) {
+			continue
+		}
+		start := list[0]
+		if m := reHeader.FindStringIndex(content[last:start]); m != nil {
+			start = last + m[0]
+		}
+		result.WriteString(content[last:start])
+		result.WriteString(h.footnoteDefinitions(items, reItemAnchor))
+		last = list[3]
+	}
+	result.WriteString(content[last:])
+	return result.String()
+}
+
+// footnoteDefinitions 将 Notes 区的列表项还原为 [^1]: 定义，后续段落与列表缩进四个空格
+func (h *ContentHandler) footnoteDefinitions(items string, reItemAnchor *regexp.Regexp) string {
+	reBacklink := regexp.MustCompile(`(?s)\s*<ac:link[^>]*?ac:anchor="fnref-[\d-]+"[^>]*?>.*?</ac:link>`)
+	inline := func(s string) string {
+		return strings.TrimSpace(h.cleanHTML(h.convertTextFormatting(s)))
+	}
+
+	var result strings.Builder
+	result.WriteString("\n")
+	for _, item := range outerElements(items, "li") {
+		body := items[item[1]:item[2]]
+		m := reItemAnchor.FindStringSubmatch(body)
+		if m == nil {
+			continue
+		}
+		body = reItemAnchor.ReplaceAllString(body, "")
+		body = reBacklink.ReplaceAllString(body, "")
+
+		var blocks []string
+		for _, block := range outerElements(body, `p|ol|ul`) {
+			inner := body[block[1]:block[2]]
+			open := body[block[0]:block[1]]
+			if strings.HasPrefix(open, "<p") {
+				blocks = append(blocks, inline(inner))
+				continue
+			}
+			var lines []string
+			for i, li := range outerElements(inner, "li") {
+				marker := "-"
+				if strings.HasPrefix(open, "<ol") {
+					marker = fmt.Sprintf("%d.", i+1)
+				}
+				lines = append(lines, marker+" "+inline(inner[li[1]:li[2]]))
+			}
+			blocks = append(blocks, strings.Join(lines, "\n    "))
+		}
+		if len(blocks) == 0 {
+			blocks = append(blocks, inline(body))
+		}
+
+		result.WriteString(fmt.Sprintf("[^%s]: %s\n", m[1], strings.Join(blocks, "\n\n    ")))
+		if len(blocks) > 1 {
+			// 多块脚注之后空一行，避免下一条定义被并入其最后一块
+			result.WriteString("\n")
+		}
+	}
+	result.WriteString("\n")
+	return result.String()
+}
+
+// outerElements 查找最外层的指定元素，嵌套的同名元素计入其父元素
+// tags 为元素名称的正则，如 p|ol|ul；返回开始标签起止位置与结束标签起止位置
+func outerElements(content, tags string) [][4]int {
+	reTag := regexp.MustCompile(`<(/?)(?:` + tags + `)(?:\s[^>]*)?>`)
+	var elements [][4]int
+	var open [2]int
+	depth := 0
+	for _, m := range reTag.FindAllStringSubmatchIndex(content, -1) {
+		if m[3] > m[2] {
+			if depth == 0 {
+				continue
+			}
+			depth--
+			if depth == 0 {
+				elements = append(elements, [4]int{open[0], open[1], m[0], m[1]})
+			}
+			continue
+		}
+		if strings.HasSuffix(content[m[0]:m[1]], "/>") {
+			continue
+		}
+		if depth == 0 {
+			open = [2]int{m[0], m[1]}
+		}
+		depth++
+	}
+	return elements
+}
+
+// convertAnchorLinks 将页内锚点链接还原为 [text](#slug)，并移除锚点宏，需在段落转换之前执行
+func (h *ContentHandler) convertAnchorLinks(content string) string {
+	// 标题锚点映射为 GitHub 风格的 slug
+	// 重复标题: Confluence 锚点追加 .N，GitHub slug 追加 -N
+	slugs := make(map[string]string)
+	counts := make(map[string]int)
+	reHeading := regexp.MustCompile(`(?s)<h[1-6][^>]*>(.*?)</h[1-6]>`)
+	for _, m := range reHeading.FindAllStringSubmatch(content, -1) {
+		text := h.cleanHTML(regexp.MustCompile(`(?s)<ac:structured-macro.*?</ac:structured-macro>`).ReplaceAllString(m[1], ""))
+		anchor, slug := HeadingAnchor(text), HeadingSlug(text)
+		if n := counts[anchor]; n > 0 {
+			anchor = fmt.Sprintf("%s.%d", anchor, n)
+			slug = fmt.Sprintf("%s-%d", slug, n)
+		}
+		counts[HeadingAnchor(text)]++
+		slugs[anchor] = slug
+	}
+
+	// 移除锚点宏
+	content = regexp.MustCompile(`(?s)<ac:structured-macro[^>]*?ac:name="anchor"[^>]*?>.*?</ac:structured-macro>`).ReplaceAllString(content, "")
+
+	// 仅处理不指向其他页面或附件的链接
+	re := regexp.MustCompile(`(?s)<ac:link[^>]*?ac:anchor="([^"]*)"[^>]*?>(.*?)</ac:link>`)
+	return re.ReplaceAllStringFunc(content, func(match string) string {
+		submatches := re.FindStringSubmatch(match)
+		anchor := unescapeXML(submatches[1])
+		inner := submatches[2]
+		if strings.Contains(inner, "<ri:") {
+			return match
+		}
+
+		text := ""
+		if m := regexp.MustCompile(`(?s)<ac:plain-text-link-body><!\[CDATA\[(.*?)\]\]></ac:plain-text-link-body>`).FindStringSubmatch(inner); m != nil {
+			text = m[1]
+		} else if m := regexp.MustCompile(`(?s)<ac:link-body>(.*?)</ac:link-body>`).FindStringSubmatch(inner); m != nil {
+			text = h.cleanHTML(m[1])
+		}
+		if strings.TrimSpace(text) == "" {
+			text = anchor
+		}
+
+		slug, ok := slugs[anchor]
+		if !ok {
+			slug = HeadingSlug(anchor)
+		}
+		return fmt.Sprintf("[%s](#%s)", text, slug)
+	})
+}
+
 // convertHeadings 转换标题
 func (h *ContentHandler) convertHeadings(content string) string {
 	// 转换 h1-h6 标签
@@ -130,63 +336,157 @@ func (h *ContentHandler) convertOrderedLists(content string) string {
 	})
 }
 
-// convertTables 转换表格
+// convertTables 转换表格，需在段落转换之前执行以保留单元格内的行内格式
+// 含合并单元格或标题列的表格无法用 Markdown 表示，回退为 HTML 表格
 func (h *ContentHandler) convertTables(content string) string {
 	reTable := regexp.MustCompile(`(?s)<table[^>]*>(.*?)</table>`)
 	reRow := regexp.MustCompile(`(?s)<tr[^>]*>(.*?)</tr>`)
-	reHeader := regexp.MustCompile(`(?s)<th[^>]*>(.*?)</th>`)
-	reCell := regexp.MustCompile(`(?s)<td[^>]*>(.*?)</td>`)
+	reCell := regexp.MustCompile(`(?s)<(th|td)([^>]*)>(.*?)</(?:th|td)>`)
 
 	return reTable.ReplaceAllStringFunc(content, func(table string) string {
-		rows := reRow.FindAllString(table, -1)
+		rows := reRow.FindAllStringSubmatch(table, -1)
 		if len(rows) == 0 {
 			return table
 		}
 
-		var result strings.Builder
-		
-		// 处理表头
-		headerRow := rows[0]
-		headers := reHeader.FindAllStringSubmatch(headerRow, -1)
-		if len(headers) == 0 {
-			headers = reCell.FindAllStringSubmatch(headerRow, -1)
+		var cells [][][]string
+		for _, row := range rows {
+			cells = append(cells, reCell.FindAllStringSubmatch(row[1], -1))
 		}
-		
-		// 写入表头
-		for i, header := range headers {
-			if i > 0 {
-				result.WriteString(" | ")
+		if h.needsHTMLTable(cells) {
+			return h.tableToHTML(rows, cells)
+		}
+
+		// 列数以最宽的行为准
+		columns := 0
+		for _, row := range cells {
+			if len(row) > columns {
+				columns = len(row)
 			}
-			result.WriteString(h.cleanHTML(header[1]))
 		}
-		result.WriteString("\n")
+		if columns == 0 {
+			return table
+		}
 
-		// 写入分隔行
-		for i := range headers {
-			if i > 0 {
-				result.WriteString(" | ")
+		var result strings.Builder
+		writeRow := func(row [][]string) {
+			values := make([]string, columns)
+			for i, cell := range row {
+				values[i] = h.convertTableCell(cell[3])
 			}
-			result.WriteString("---")
+			result.WriteString("| " + strings.Join(values, " | ") + " |\n")
 		}
-		result.WriteString("\n")
 
-		// 处理数据行
-		for i := 1; i < len(rows); i++ {
-			cells := reCell.FindAllStringSubmatch(rows[i], -1)
-			for j, cell := range cells {
-				if j > 0 {
-					result.WriteString(" | ")
+		// 写入表头
+		writeRow(cells[0])
+
+		// 写入分隔行，对齐方式取自表头或第一行数据
+		separators := make([]string, columns)
+		for i := range separators {
+			separators[i] = "---"
+		}
+		for r := min(1, len(cells)-1); r >= 0; r-- {
+			for i, cell := range cells[r] {
+				switch cellAlignment(cell[2]) {
+				case "left":
+					separators[i] = ":---"
+				case "center":
+					separators[i] = ":---:"
+				case "right":
+					separators[i] = "---:"
 				}
-				result.WriteString(h.cleanHTML(cell[1]))
 			}
-			result.WriteString("\n")
+		}
+		result.WriteString("| " + strings.Join(separators, " | ") + " |\n")
+
+		// 写入数据行
+		for _, row := range cells[1:] {
+			writeRow(row)
 		}
 		result.WriteString("\n")
 
-		return result.String()
+		return "\n" + result.String()
 	})
 }
 
+// needsHTMLTable 判断表格是否包含 Markdown 无法表示的合并单元格或标题列
+func (h *ContentHandler) needsHTMLTable(cells [][][]string) bool {
+	reSpan := regexp.MustCompile(`(?:colspan|rowspan)="(\d+)"`)
+	for r, row := range cells {
+		for _, cell := range row {
+			for _, m := range reSpan.FindAllStringSubmatch(cell[2], -1) {
+				if m[1] != "1" {
+					return true
+				}
+			}
+			if r > 0 && cell[1] == "th" {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// tableToHTML 将表格转换为精简的 HTML 表格，保留合并单元格与对齐方式
+func (h *ContentHandler) tableToHTML(rows [][]string, cells [][][]string) string {
+	reAttr := regexp.MustCompile(`(colspan|rowspan)="\d+"`)
+
+	var result strings.Builder
+	result.WriteString("\n<table>\n")
+	for _, row := range cells {
+		result.WriteString("<tr>")
+		for _, cell := range row {
+			attrs := strings.Join(reAttr.FindAllString(cell[2], -1), " ")
+			if align := cellAlignment(cell[2]); align != "" {
+				attrs = strings.TrimSpace(attrs + ` style="text-align: ` + align + `;"`)
+			}
+			if attrs != "" {
+				attrs = " " + attrs
+			}
+
+			inner := strings.TrimSpace(cell[3])
+			inner = regexp.MustCompile(`(?s)</p>\s*<p[^>]*>`).ReplaceAllString(inner, "<br/>")
+			inner = regexp.MustCompile(`</?p[^>]*>`).ReplaceAllString(inner, "")
+			result.WriteString("<" + cell[1] + attrs + ">" + inner + "</" + cell[1] + ">")
+		}
+		result.WriteString("</tr>\n")
+	}
+	result.WriteString("</table>\n\n")
+	return result.String()
+}
+
+// convertTableCell 将单元格内容转换为单行 Markdown，保留加粗、代码与链接，并转义 |
+func (h *ContentHandler) convertTableCell(content string) string {
+	content = strings.TrimSpace(content)
+	// 多个段落或换行使用 <br> 连接
+	content = regexp.MustCompile(`(?s)</p>\s*<p[^>]*>`).ReplaceAllString(content, "<br/>")
+	content = regexp.MustCompile(`<br\s*/?>|\n`).ReplaceAllString(content, "BR_PLACEHOLDER")
+
+	content = h.convertLinks(content)
+	content = h.convertTextFormatting(content)
+	content = strings.TrimSpace(h.cleanHTML(content))
+
+	content = strings.ReplaceAll(content, "|", "\\|")
+	var parts []string
+	for _, part := range strings.Split(content, "BR_PLACEHOLDER") {
+		if part = strings.TrimSpace(part); part != "" {
+			parts = append(parts, part)
+		}
+	}
+	return strings.Join(parts, "<br>")
+}
+
+// cellAlignment 从单元格属性中提取对齐方式
+func cellAlignment(attrs string) string {
+	if m := regexp.MustCompile(`text-align:\s*(left|center|right)`).FindStringSubmatch(attrs); m != nil {
+		return m[1]
+	}
+	if m := regexp.MustCompile(`align="(left|center|right)"`).FindStringSubmatch(attrs); m != nil {
+		return m[1]
+	}
+	return ""
+}
+
 // convertLinks 转换链接
 func (h *ContentHandler) convertLinks(content string) string {
 	re := regexp.MustCompile(`<a[^>]+href="([^"]+)"[^>]*>(.*?)</a>`)
@@ -213,11 +513,16 @@ func (h *ContentHandler) convertImages(content string) string {
 	})
 
 	// 转换 Confluence 图片宏
-	reMacro := regexp.MustCompile(`<ac:image[^>]*?>(?:<ri:attachment[^>]*?ri:filename="([^"]+)"[^>]*?>)?(?:<ac:parameter[^>]*?ac:name="alt"[^>]*?>(.*?)</ac:parameter>)?</ac:image>`)
+	reMacro := regexp.MustCompile(`<ac:image[^>]*?>(?:<ri:attachment[^>]*?ri:filename="([^"]+)"[^>]*?>(?:<ri:page[^>]*?/></ri:attachment>)?)?(?:<ac:parameter[^>]*?ac:name="alt"[^>]*?>(.*?)</ac:parameter>)?</ac:image>`)
 	return reMacro.ReplaceAllStringFunc(content, func(match string) string {
 		submatches := reMacro.FindStringSubmatch(match)
 		filename := submatches[1]
 		alt := submatches[2]
+		if alt == "" {
+			if m := regexp.MustCompile(`^<ac:image[^>]*?\sac:alt="([^"]*)"`).FindStringSubmatch(match); len(m) >= 2 {
+				alt = html.UnescapeString(m[1])
+			}
+		}
 		if alt == "" {
 			alt = filename
 		}
@@ -231,20 +536,22 @@ func (h *ContentHandler) convertImages(content string) string {
 // convertCodeBlocks 转换代码块
 func (h *ContentHandler) convertCodeBlocks(content string) string {
 	// 转换 Confluence 代码宏
-	reMacro := regexp.MustCompile(`<ac:structured-macro[^>]*?ac:name="code"[^>]*?>(?s)(?:<ac:parameter[^>]*?ac:name="language"[^>]*?>(?:(.*?))</ac:parameter>)?(?:<ac:parameter[^>]*?ac:name="title"[^>]*?>(?:(.*?))</ac:parameter>)?.*?<ac:plain-text-body><!\[CDATA\[(.*?)\]\]></ac:plain-text-body>.*?</ac:structured-macro>`)
+	reMacro := regexp.MustCompile(`(?s)<ac:structured-macro[^>]*?ac:name="code"[^>]*?>(.*?)<ac:plain-text-body><!\[CDATA\[(.*?)\]\]></ac:plain-text-body>.*?</ac:structured-macro>`)
 	content = reMacro.ReplaceAllStringFunc(content, func(match string) string {
 		submatches := reMacro.FindStringSubmatch(match)
-		language := strings.TrimSpace(submatches[1])
-		title := strings.TrimSpace(submatches[2])
-		code := strings.TrimSpace(submatches[3])
+		params := parseMacroParameters(submatches[1])
+		language := strings.TrimSpace(params["language"])
+		code := strings.Trim(strings.ReplaceAll(submatches[2], "]]&gt;", "]]>"), "\n")
+		info := codeInfoString(params)
+		if language == "" && info != "" {
+			language = "text"
+		}
 		
 		var result strings.Builder
-		if title != "" {
-			result.WriteString(fmt.Sprintf("**%s**\n", title))
-		}
 		result.WriteString("```")
-		if language != "" {
-			result.WriteString(language)
+		result.WriteString(language)
+		if info != "" {
+			result.WriteString(" " + info)
 		}
 		result.WriteString("\n")
 		result.WriteString(code)
@@ -263,10 +570,31 @@ func (h *ContentHandler) convertCodeBlocks(content string) string {
 	return content
 }
 
+// codeInfoString 将代码宏参数还原为围栏代码块的信息字符串
+func codeInfoString(params map[string]string) string {
+	var options []string
+	if title := strings.TrimSpace(params["title"]); title != "" {
+		options = append(options, fmt.Sprintf("title=%q", title))
+	}
+	if params["linenumbers"] == "true" {
+		options = append(options, "linenos")
+	}
+	if params["collapse"] == "true" {
+		options = append(options, "collapse")
+	}
+	if theme := strings.TrimSpace(params["theme"]); theme != "" {
+		options = append(options, "theme="+theme)
+	}
+	if firstline := strings.TrimSpace(params["firstline"]); firstline != "" && firstline != "1" {
+		options = append(options, "firstline="+firstline)
+	}
+	return strings.Join(options, " ")
+}
+
 // convertMacros 转换 Confluence 宏
 func (h *ContentHandler) convertMacros(content string) string {
-	// 转换 Mermaid 图表宏
-	content = h.convertMermaidMacros(content)
+	// 转换代码块映射的宏（Mermaid、PlantUML 等）
+	content = h.convertCodeMacros(content)
 	// 转换展开宏
 	content = h.convertExpandMacros(content)
 	// 转换信息面板宏
@@ -278,15 +606,117 @@ func (h *ContentHandler) convertMacros(content string) string {
 	return content
 }
 
-// convertMermaidMacros 转换 Mermaid 图表宏
-func (h *ContentHandler) convertMermaidMacros(content string) string {
-	re := regexp.MustCompile(`<ac:structured-macro[^>]*?ac:name="markdown"[^>]*?>.*?<ac:plain-text-body><!\[CDATA\[(.*?)\]\]></ac:plain-text-body>.*?</ac:structured-macro>`)
+// convertCodeMacros 按代码块宏映射将宏还原为围栏代码块
+func (h *ContentHandler) convertCodeMacros(content string) string {
+	var names []string
+	for _, mapping := range h.codeMacros {
+		if mapping.Macro != "code" {
+			names = append(names, regexp.QuoteMeta(mapping.Macro))
+		}
+	}
+	if len(names) == 0 {
+		return content
+	}
+
+	re := regexp.MustCompile(`(?s)<ac:structured-macro[^>]*?ac:name="(` + strings.Join(names, "|") + `)"[^>]*?>(.*?)</ac:structured-macro>`)
 	return re.ReplaceAllStringFunc(content, func(match string) string {
-		mermaid := strings.TrimSpace(re.FindStringSubmatch(match)[1])
-		return mermaid + "\n"
+		submatches := re.FindStringSubmatch(match)
+		name := submatches[1]
+		inner := submatches[2]
+
+		params := parseMacroParameters(inner)
+		mapping, ok := h.findCodeMacro(name, params)
+		if !ok {
+			return match
+		}
+
+		body := ""
+		if m := regexp.MustCompile(`(?s)<ac:plain-text-body><!\[CDATA\[(.*?)\]\]></ac:plain-text-body>`).FindStringSubmatch(inner); m != nil {
+			body = strings.ReplaceAll(m[1], "]]&gt;", "]]>")
+		}
+
+		switch mapping.Body {
+		case config.CodeMacroBodyFenced:
+			return strings.TrimSpace(body) + "\n"
+		case config.CodeMacroBodyNone:
+			var result strings.Builder
+			result.WriteString("```" + mapping.Language + "\n")
+			for _, param := range sortedKeys(params) {
+				if mapping.Parameters[param] == params[param] {
+					continue
+				}
+				result.WriteString(param + "=" + params[param] + "\n")
+			}
+			result.WriteString("```\n")
+			return result.String()
+		default:
+			return "```" + mapping.Language + "\n" + strings.Trim(body, "\n") + "\n```\n"
+		}
 	})
 }
 
+// findCodeMacro 查找宏对应的代码块映射，优先选择参数完全匹配的映射
+func (h *ContentHandler) findCodeMacro(name string, params map[string]string) (config.CodeMacroConfig, bool) {
+	var candidate *config.CodeMacroConfig
+	for i, mapping := range h.codeMacros {
+		// code 宏由 convertCodeBlocks 处理
+		if mapping.Macro != name || mapping.Macro == "code" {
+			continue
+		}
+		matched := true
+		for param, value := range mapping.Parameters {
+			if params[param] != value {
+				matched = false
+				break
+			}
+		}
+		if matched {
+			return mapping, true
+		}
+		if candidate == nil {
+			candidate = &h.codeMacros[i]
+		}
+	}
+	if candidate != nil {
+		return *candidate, true
+	}
+	return config.CodeMacroConfig{}, false
+}
+
+// parseMacroParameters 解析宏的参数
+func parseMacroParameters(macro string) map[string]string {
+	params := make(map[string]string)
+	re := regexp.MustCompile(`(?s)<ac:parameter[^>]*?ac:name="([^"]*)"[^>]*?>(.*?)</ac:parameter>`)
+	for _, m := range re.FindAllStringSubmatch(macro, -1) {
+		if _, exists := params[m[1]]; !exists {
+			params[m[1]] = unescapeXML(m[2])
+		}
+	}
+	return params
+}
+
+// unescapeXML 还原 XML 实体
+func unescapeXML(s string) string {
+	return strings.NewReplacer(
+		"&lt;", "<",
+		"&gt;", ">",
+		"&quot;", "\"",
+		"&apos;", "'",
+		"&#39;", "'",
+		"&amp;", "&",
+	).Replace(s)
+}
+
+// sortedKeys 返回按字母排序的键
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
 // convertExpandMacros 转换展开宏
 func (h *ContentHandler) convertExpandMacros(content string) string {
 	re := regexp.MustCompile(`<ac:structured-macro[^>]*?ac:name="expand"[^>]*?>.*?<ac:parameter[^>]*?ac:name="title"[^>]*?>(.*?)</ac:parameter>.*?<ac:rich-text-body>(.*?)</ac:rich-text-body>.*?</ac:structured-macro>`)
@@ -471,65 +901,82 @@ func (h *ContentHandler) convertAttachments(content string) string {
 	})
 }
 
-// convertEmojis 转换表情符号
+// convertEmojis 转换表情符号，需在段落转换之前执行
 func (h *ContentHandler) convertEmojis(content string) string {
 	// 转换 Confluence 表情宏
 	re := regexp.MustCompile(`<ac:emoticon[^>]*?ac:name="([^"]+)"[^>]*?/>`)
 	return re.ReplaceAllStringFunc(content, func(match string) string {
-		emoji := re.FindStringSubmatch(match)[1]
-		// 映射常见的表情符号
-		emojiMap := map[string]string{
-			"smile":        ":smile:",
-			"sad":         ":sad:",
-			"wink":        ":wink:",
-			"laugh":       ":laughing:",
-			"thumbs-up":   ":+1:",
-			"thumbs-down": ":-1:",
-			"information": ":information_source:",
-			"tick":        ":white_check_mark:",
-			"cross":       ":x:",
-			"warning":     ":warning:",
-		}
-		if replacement, ok := emojiMap[emoji]; ok {
-			return replacement
-		}
-		return ":" + emoji + ":"
+		return ":" + EmoticonShortcode(re.FindStringSubmatch(match)[1]) + ":"
 	})
 }
 
-// convertMentions 转换@提及
+// convertMentions 转换@提及，需在段落转换之前执行
+// 用户以用户名表示，页面中只有 userkey 或 account ID 时保留该 ID，上传时可再次解析
 func (h *ContentHandler) convertMentions(content string) string {
 	// 转换用户提及
-	re := regexp.MustCompile(`<ac:link[^>]*?><ri:user[^>]*?ri:username="([^"]+)"[^>]*?/></ac:link>`)
-	content = re.ReplaceAllString(content, "@$1")
-	
+	re := regexp.MustCompile(`(?s)<ac:link[^>]*?>\s*<ri:user[^>]*?ri:(?:username|userkey|account-id)="([^"]+)"[^>]*?/>.*?</ac:link>`)
+	content = re.ReplaceAllStringFunc(content, func(match string) string {
+		return h.mentionSyntax(re.FindStringSubmatch(match)[1])
+	})
+
 	// 转换组提及
 	reGroup := regexp.MustCompile(`<ac:link[^>]*?><ri:group[^>]*?ri:name="([^"]+)"[^>]*?/></ac:link>`)
 	content = reGroup.ReplaceAllString(content, "@$1")
-	
+
 	return content
 }
 
-// convertStatus 转换状态宏
+// mentionSyntax 按配置的提及语法输出用户
+func (h *ContentHandler) mentionSyntax(name string) string {
+	return h.mentions.Prefix + name + h.mentions.Suffix
+}
+
+// convertJiraMacros 转换 jira 宏为配置的引用语法，需在段落转换之前执行
+// 仅处理单个问题的宏，JQL 查询等其他形式保持原逻辑
+func (h *ContentHandler) convertJiraMacros(content string) string {
+	re := regexp.MustCompile(`(?s)<ac:structured-macro[^>]*?ac:name="jira"[^>]*?>.*?</ac:structured-macro>`)
+	return re.ReplaceAllStringFunc(content, func(match string) string {
+		key := strings.TrimSpace(parseMacroParameters(match)["key"])
+		if key == "" {
+			return match
+		}
+		if h.jira.Syntax != config.JiraSyntaxWiki && h.isJiraProjectKey(key) {
+			return key
+		}
+		// 不属于已配置项目的问题编号无法以裸编号发布回去
+		return "[[jira:" + key + "]]"
+	})
+}
+
+// isJiraProjectKey 判断问题编号是否属于配置的项目
+func (h *ContentHandler) isJiraProjectKey(key string) bool {
+	if len(h.jira.Projects) == 0 {
+		return false
+	}
+	re, err := regexp.Compile(`^(?:` + strings.Join(h.jira.Projects, "|") + `)-[0-9]+$`)
+	return err == nil && re.MatchString(key)
+}
+
+// convertStatus 转换状态宏为 {status:colour|title} 语法，需在段落转换之前执行
 func (h *ContentHandler) convertStatus(content string) string {
-	re := regexp.MustCompile(`<ac:structured-macro[^>]*?ac:name="status"[^>]*?>.*?<ac:parameter[^>]*?ac:name="title"[^>]*?>(.*?)</ac:parameter>.*?<ac:parameter[^>]*?ac:name="colour"[^>]*?>(.*?)</ac:parameter>.*?</ac:structured-macro>`)
+	re := regexp.MustCompile(`(?s)<ac:structured-macro[^>]*?ac:name="status"[^>]*?>.*?</ac:structured-macro>`)
 	return re.ReplaceAllStringFunc(content, func(match string) string {
-		submatches := re.FindStringSubmatch(match)
-		status := submatches[1]
-		color := submatches[2]
-		
-		// 根据颜色添加不同的标记
-		switch color {
-		case "Green":
-			return fmt.Sprintf("✅ %s", status)
-		case "Red":
-			return fmt.Sprintf("❌ %s", status)
-		case "Yellow":
-			return fmt.Sprintf("⚠️ %s", status)
-		case "Blue":
-			return fmt.Sprintf("ℹ️ %s", status)
-		default:
-			return fmt.Sprintf("【%s】", status)
+		params := parseMacroParameters(match)
+		title := strings.ReplaceAll(params["title"], "}", ")")
+		if title == "" {
+			return ""
+		}
+
+		var options []string
+		if colour := strings.ToLower(params["colour"]); colour != "" && colour != "grey" {
+			options = append(options, colour)
+		}
+		if params["subtle"] == "true" {
+			options = append(options, "subtle")
+		}
+		if len(options) == 0 {
+			return fmt.Sprintf("{status|%s}", title)
 		}
+		return fmt.Sprintf("{status:%s|%s}", strings.Join(options, ","), title)
 	})
 }
@@ -0,0 +1,85 @@
+package confluence_test
+
+import (
+	"testing"
+
+	"github.com/HelloAnner/markdown-sync-confluence/pkg/config"
+	"github.com/HelloAnner/markdown-sync-confluence/pkg/confluence"
+	"github.com/HelloAnner/markdown-sync-confluence/pkg/markdown"
+	"github.com/stretchr/testify/assert"
+)
+
+// roundTrip 发布转换后再下载转换，发布时不插入目录
+func roundTrip(t *testing.T, cfg *config.Config, source string) string {
+	t.Helper()
+	publisher := markdown.NewContentHandler(cfg)
+	publisher.SetFrontMatter(map[string]interface{}{"toc": false})
+	storage, err := publisher.ConvertToConfluence(source)
+	assert.NoError(t, err)
+
+	result, err := confluence.NewContentHandler(cfg).ConvertToMarkdown(storage)
+	assert.NoError(t, err)
+	return result
+}
+
+func TestTableAlignment(t *testing.T) {
+	handler := confluence.NewContentHandler(nil)
+
+	result, err := handler.ConvertToMarkdown(`<table><tbody>` +
+		`<tr><th style="text-align: left;">A</th><th style="text-align: center;">B</th><th>C</th></tr>` +
+		`<tr><td style="text-align: left;">1</td><td style="text-align: center;">2</td><td style="text-align: right;">3</td></tr>` +
+		`<tr><td style="text-align: left;">4</td><td style="text-align: center;">5</td><td style="text-align: right;">6</td></tr>` +
+		`</tbody></table>`)
+	assert.NoError(t, err)
+	assert.Contains(t, result, "| A | B | C |\n| :--- | :---: | ---: |\n| 1 | 2 | 3 |\n| 4 | 5 | 6 |\n")
+}
+
+func TestFootnotesRoundTrip(t *testing.T) {
+	source := "Text[^1] and more[^2].\n\n[^1]: note\n\n    1. one\n    2. two\n\n[^2]: Simple *x*.\n"
+	result := roundTrip(t, nil, source)
+	assert.Equal(t, source, result)
+
+	// 普通有序列表不当作脚注区
+	result = roundTrip(t, nil, "1. one\n2. two\n")
+	assert.Equal(t, "1. one\n2. two\n", result)
+}
+
+func TestStatusRoundTrip(t *testing.T) {
+	source := "{status:green|DONE} {status:red,subtle|Blocked} {status|TODO}\n"
+	assert.Equal(t, source, roundTrip(t, nil, source))
+}
+
+func TestJiraRoundTrip(t *testing.T) {
+	cfg := &config.Config{}
+	cfg.Markdown.Jira = config.JiraConfig{Enabled: true, Projects: []string{"PROJ"}}
+	assert.Equal(t, "Fix PROJ-1 and PROJ-2\n", roundTrip(t, cfg, "Fix PROJ-1 and [[jira:PROJ-2]]\n"))
+
+	// 未配置项目时还原为 [[jira:KEY]]
+	cfg.Markdown.Jira.Projects = nil
+	assert.Equal(t, "Fix [[jira:PROJ-2]]\n", roundTrip(t, cfg, "Fix [[jira:PROJ-2]]\n"))
+}
+
+func TestMathRoundTrip(t *testing.T) {
+	source := "Euler $e^{i\\pi}+1=0$ and $a < b$.\n\n$$\nx_1 * y_2\n$$\n"
+	assert.Equal(t, source, roundTrip(t, nil, source))
+}
+
+func TestCodeMacrosRoundTrip(t *testing.T) {
+	cfg := &config.Config{
+		Markdown: config.MarkdownConfig{
+			CodeMacros: []config.CodeMacroConfig{
+				{Language: "plantuml", Macro: "plantuml"},
+			},
+		},
+	}
+	source := "```python title=\"main.py\" linenos\nprint(1)\n```\n\n```plantuml\nA -> B\n```\n\n```mermaid\ngraph TD\n```\n"
+	assert.Equal(t, source, roundTrip(t, cfg, source))
+
+	// 别名映射为 Confluence 语言名
+	assert.Equal(t, "```go\nfunc main() {}\n```\n", roundTrip(t, nil, "```golang\nfunc main() {}\n```\n"))
+}
+
+func TestAnchorsRoundTrip(t *testing.T) {
+	source := "# Install Guide\n\n## Usage\n\n## Usage\n\nSee [guide](#install-guide), [use](#usage) and [again](#usage-1).\n"
+	assert.Equal(t, source, roundTrip(t, nil, source))
+}
@@ -0,0 +1,61 @@
+package confluence
+
+// emoticonShortcodes Confluence 表情名称到 Markdown 短代码的映射（下载时使用）
+var emoticonShortcodes = map[string]string{
+	"smile":        "smile",
+	"sad":          "sad",
+	"cheeky":       "stuck_out_tongue",
+	"laugh":        "laughing",
+	"wink":         "wink",
+	"thumbs-up":    "+1",
+	"thumbs-down":  "-1",
+	"information":  "information_source",
+	"tick":         "white_check_mark",
+	"cross":        "x",
+	"warning":      "warning",
+	"plus":         "heavy_plus_sign",
+	"minus":        "heavy_minus_sign",
+	"question":     "question",
+	"light-on":     "bulb",
+	"light-off":    "light_off",
+	"yellow-star":  "star",
+	"red-star":     "red_star",
+	"green-star":   "green_star",
+	"blue-star":    "blue_star",
+	"heart":        "heart",
+	"broken-heart": "broken_heart",
+}
+
+// shortcodeAliases 常见的同义短代码（上传时使用）
+var shortcodeAliases = map[string]string{
+	"slightly_smiling_face": "smile",
+	"smiley":                "smile",
+	"disappointed":          "sad",
+	"thumbsup":              "thumbs-up",
+	"thumbsdown":            "thumbs-down",
+	"heavy_check_mark":      "tick",
+	"check":                 "tick",
+	"cross_mark":            "cross",
+	"grey_question":         "question",
+}
+
+// EmoticonShortcode 返回 Confluence 表情对应的 Markdown 短代码（不含冒号）
+func EmoticonShortcode(name string) string {
+	if shortcode, ok := emoticonShortcodes[name]; ok {
+		return shortcode
+	}
+	return name
+}
+
+// EmoticonName 返回 Markdown 短代码对应的 Confluence 表情名称，不支持时返回 false
+func EmoticonName(shortcode string) (string, bool) {
+	if name, ok := shortcodeAliases[shortcode]; ok {
+		return name, true
+	}
+	for name, code := range emoticonShortcodes {
+		if code == shortcode || name == shortcode {
+			return name, true
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,140 @@
+package markdown
+
+import (
+	"html"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/HelloAnner/markdown-sync-confluence/pkg/confluence"
+	"github.com/yuin/goldmark/ast"
+)
+
+// headingIDs 生成 GitHub 风格的标题ID（保留中文等字符），实现 parser.IDs
+type headingIDs struct {
+	values map[string]bool
+}
+
+// newHeadingIDs 创建标题ID生成器
+func newHeadingIDs() *headingIDs {
+	return &headingIDs{values: make(map[string]bool)}
+}
+
+// Generate 实现 parser.IDs
+func (s *headingIDs) Generate(value []byte, kind ast.NodeKind) []byte {
+	slug := confluence.HeadingSlug(string(value))
+	if slug == "" {
+		slug = "heading"
+	}
+
+	// 重复的标题追加 -1、-2 后缀，与 GitHub 保持一致
+	id := slug
+	for i := 1; s.values[id]; i++ {
+		id = slug + "-" + strconv.Itoa(i)
+	}
+	s.values[id] = true
+	return []byte(id)
+}
+
+// Put 实现 parser.IDs
+func (s *headingIDs) Put(value []byte) {
+	s.values[string(value)] = true
+}
+
+// postProcessHeadingAnchors 让页内锚点链接在Confluence中可用
+// Confluence会丢弃标题的id属性，因此:
+//   - 标题id映射为Confluence为标题生成的锚点（去除空白的标题文本）
+//   - <a href="#id"> 页内链接改写为 <ac:link ac:anchor="...">
+//   - HTML中的 <a id="x"></a> / <a name="x"></a> 改写为锚点宏
+// 代码宏等CDATA段中的内容原样保留
+// 参数:
+//   - content: HTML内容
+// 返回:
+//   - string: 处理后的内容
+func (ch *ContentHandler) postProcessHeadingAnchors(content string) string {
+	anchors := make(map[string]string)
+	used := make(map[string]int)
+
+	// 1. 收集标题并移除id属性
+	reHeading := regexp.MustCompile(`<h([1-6]) id="([^"]*)">([\s\S]*?)</h([1-6])>`)
+	content = replaceOutsideCDATA(content, func(part string) string {
+		return reHeading.ReplaceAllStringFunc(part, func(match string) string {
+			submatches := reHeading.FindStringSubmatch(match)
+			level, id, inner := submatches[1], html.UnescapeString(submatches[2]), submatches[3]
+
+			text := html.UnescapeString(regexp.MustCompile(`<[^>]+>`).ReplaceAllString(inner, ""))
+			anchor := confluence.HeadingAnchor(text)
+			// Confluence 为重复标题追加 .1、.2 后缀
+			if n := used[anchor]; n > 0 {
+				used[anchor]++
+				anchor = anchor + "." + strconv.Itoa(n)
+			} else {
+				used[anchor] = 1
+			}
+			anchors[strings.ToLower(id)] = anchor
+			if _, exists := anchors[strings.ToLower(anchor)]; !exists {
+				anchors[strings.ToLower(anchor)] = anchor
+			}
+
+			return "<h" + level + ">" + inner + "</h" + level + ">"
+		})
+	})
+
+	// 2. 显式HTML锚点转换为锚点宏
+	reExplicit := regexp.MustCompile(`<a (?:id|name)="([^"]+)"\s*(?:/>|>\s*</a>)`)
+	content = replaceOutsideCDATA(content, func(part string) string {
+		return reExplicit.ReplaceAllStringFunc(part, func(match string) string {
+			name := html.UnescapeString(reExplicit.FindStringSubmatch(match)[1])
+			anchors[strings.ToLower(name)] = name
+			return buildMacro("anchor", map[string]string{"": name}, "")
+		})
+	})
+
+	// 3. 改写页内锚点链接
+	reLink := regexp.MustCompile(`<a href="#([^"]*)"[^>]*>([\s\S]*?)</a>`)
+	return replaceOutsideCDATA(content, func(part string) string {
+		return reLink.ReplaceAllStringFunc(part, func(match string) string {
+			submatches := reLink.FindStringSubmatch(match)
+			fragment := html.UnescapeString(submatches[1])
+			if unescaped, err := url.PathUnescape(fragment); err == nil {
+				fragment = unescaped
+			}
+			inner := submatches[2]
+
+			anchor, ok := anchors[strings.ToLower(fragment)]
+			if !ok {
+				anchor, ok = anchors[confluence.HeadingSlug(fragment)]
+			}
+			if !ok {
+				anchor = fragment
+			}
+
+			return anchorLink(anchor, inner)
+		})
+	})
+}
+
+// anchorLink 构建指向页内锚点的Confluence链接
+// 参数:
+//   - anchor: 锚点名称
+//   - inner: 链接内容（HTML）
+//
+// 返回:
+//   - string: ac:link 元素
+func anchorLink(anchor, inner string) string {
+	return `<ac:link ac:anchor="` + escapeXMLAttributeValue(anchor) + `">` + linkBody(inner) + `</ac:link>`
+}
+
+// linkBody 构建Confluence链接的内容，含标签时使用富文本，否则使用纯文本
+// 参数:
+//   - inner: 链接内容（HTML）
+//
+// 返回:
+//   - string: ac:link-body 或 ac:plain-text-link-body 元素
+func linkBody(inner string) string {
+	if strings.Contains(inner, "<") {
+		return `<ac:link-body>` + inner + `</ac:link-body>`
+	}
+	return `<ac:plain-text-link-body><![CDATA[` + escapeCDATA(html.UnescapeString(inner)) + `]]></ac:plain-text-link-body>`
+}
@@ -0,0 +1,136 @@
+package markdown
+
+import (
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+
+	"github.com/HelloAnner/markdown-sync-confluence/pkg/confluence"
+)
+
+// CleanParentAttachments 清理早期版本发布新页面时遗留在父页面上的附件
+// 只处理本工具上传的附件（备注以默认备注开头），父页面自身或其子页面仍在引用的附件会保留
+// 参数:
+//   - parentPageID: 父页面ID
+//   - dryRun: 为true时只列出将被删除的附件，不实际删除
+// 返回:
+//   - []string: 已删除（或将被删除）的附件文件名
+//   - error: 读取页面或删除附件失败时的错误
+func (c *Converter) CleanParentAttachments(parentPageID string, dryRun bool) ([]string, error) {
+	if parentPageID == "" {
+		parentPageID = c.config.Confluence.ParentPageID
+	}
+	if parentPageID == "" {
+		return nil, fmt.Errorf("必须指定父页面ID")
+	}
+
+	attachments, err := c.confluenceClient.ListAttachments(parentPageID)
+	if err != nil {
+		return nil, fmt.Errorf("获取附件列表失败: %w", err)
+	}
+
+	var candidates []confluence.Attachment
+	for _, attachment := range attachments {
+		if strings.HasPrefix(attachment.Metadata.Comment, confluence.DefaultAttachmentComment) {
+			candidates = append(candidates, attachment)
+		}
+	}
+	if len(candidates) == 0 {
+		return nil, nil
+	}
+
+	parentBody, err := c.confluenceClient.GetPageContentByID(parentPageID)
+	if err != nil {
+		return nil, fmt.Errorf("获取父页面内容失败: %w", err)
+	}
+	children, err := c.confluenceClient.ListChildPages(parentPageID)
+	if err != nil {
+		return nil, fmt.Errorf("获取子页面失败: %w", err)
+	}
+	childBodies := make([]string, 0, len(children))
+	for _, child := range children {
+		body, err := c.confluenceClient.GetPageContentByID(child.ID)
+		if err != nil {
+			return nil, fmt.Errorf("获取子页面 %s 内容失败: %w", child.Title, err)
+		}
+		childBodies = append(childBodies, body)
+	}
+
+	sort.Slice(candidates, func(i, j int) bool { return candidates[i].Title < candidates[j].Title })
+	removed := make(map[string]bool)
+	var names []string
+	for _, attachment := range candidates {
+		if parentAttachmentInUse(attachment.Title, parentPageID, parentBody, childBodies) {
+			fmt.Fprintf(c.out, "ℹ️ 提示: 附件 %s 仍被引用，已保留\n", attachment.Title)
+			continue
+		}
+		if dryRun {
+			fmt.Fprintf(c.out, "🗑️ 将删除附件: %s\n", attachment.Title)
+		} else {
+			if err := c.confluenceClient.DeleteAttachment(attachment.ID); err != nil {
+				return names, fmt.Errorf("删除附件 %s 失败: %w", attachment.Title, err)
+			}
+			fmt.Fprintf(c.out, "🗑️ 已删除附件: %s\n", attachment.Title)
+			removed[attachment.Title] = true
+		}
+		names = append(names, attachment.Title)
+	}
+
+	c.imageHandler.forgetAttachments(parentPageID, removed)
+	return names, nil
+}
+
+// parentAttachmentInUse 判断父页面上的附件是否仍被引用
+// 父页面直接以文件名引用；子页面以附带 ri:page 的附件引用或下载地址引用
+// 参数:
+//   - filename: 附件文件名
+//   - parentPageID: 父页面ID
+//   - parentBody: 父页面的存储格式内容
+//   - childBodies: 子页面的存储格式内容
+// 返回:
+//   - bool: 是否仍被引用
+func parentAttachmentInUse(filename, parentPageID, parentBody string, childBodies []string) bool {
+	reference := `ri:filename="` + escapeXMLAttributeValue(filename) + `"`
+	if strings.Contains(parentBody, reference) || referencesDownloadPath(parentBody, filename, parentPageID) {
+		return true
+	}
+
+	for _, body := range childBodies {
+		if strings.Contains(body, reference+"><ri:page") || referencesDownloadPath(body, filename, parentPageID) {
+			return true
+		}
+	}
+	return false
+}
+
+// referencesDownloadPath 判断内容中是否以下载地址（如 ri:url 或链接）引用父页面的附件
+// 参数:
+//   - body: 存储格式内容
+//   - filename: 附件文件名
+//   - parentPageID: 父页面ID
+// 返回:
+//   - bool: 是否引用
+func referencesDownloadPath(body, filename, parentPageID string) bool {
+	downloadPath := "/download/attachments/" + parentPageID + "/"
+	return strings.Contains(body, downloadPath+url.PathEscape(filename)) ||
+		strings.Contains(body, downloadPath+escapeXMLAttributeValue(filename))
+}
+
+// forgetAttachments 从附件缓存中删除页面上已删除附件的记录
+func (h *ImageHandler) forgetAttachments(pageID string, filenames map[string]bool) {
+	if len(filenames) == 0 {
+		return
+	}
+	cache := h.attachmentCache()
+	if cache == nil {
+		return
+	}
+	cache.removeAttachments(pageID, filenames)
+	if err := cache.save(); err != nil {
+		fmt.Fprintf(h.out, "⚠️ 警告: 保存附件缓存失败: %v\n", err)
+	}
+	if h.attachmentsPage == pageID {
+		h.attachmentsPage = ""
+	}
+}
@@ -0,0 +1,123 @@
+package markdown
+
+import (
+	"fmt"
+	"html"
+	"mime"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// viewFileExtensions 可以用 view-file 宏预览的文件类型
+var viewFileExtensions = map[string]bool{
+	".pdf": true, ".doc": true, ".docx": true, ".xls": true, ".xlsx": true, ".ppt": true, ".pptx": true,
+}
+
+// fileLinkPattern 存储格式中的普通链接
+var fileLinkPattern = regexp.MustCompile(`<a href="([^"]+)"[^>]*>([\s\S]*?)</a>`)
+
+// processFileLinks 将指向本地文件的链接上传为附件，并改写为附件链接
+// 需要在配置中开启；代码块等CDATA段中的链接保持不变
+// 参数:
+//   - content: 存储格式内容
+// 返回:
+//   - string: 处理后的内容
+func (h *ImageHandler) processFileLinks(content string) string {
+	if !h.attachmentsConfig.Enabled || h.markdownDir == "" {
+		return content
+	}
+
+	return replaceOutsideCDATA(content, func(part string) string {
+		return fileLinkPattern.ReplaceAllStringFunc(part, h.replaceFileLink)
+	})
+}
+
+// replaceFileLink 上传链接指向的本地文件，并改写为附件链接
+// 参数:
+//   - match: 匹配到的 <a> 链接
+// 返回:
+//   - string: 附件链接或 view-file 宏，不是本地文件时为原链接
+func (h *ImageHandler) replaceFileLink(match string) string {
+	submatches := fileLinkPattern.FindStringSubmatch(match)
+	href, inner := html.UnescapeString(submatches[1]), submatches[2]
+
+	path, ok := h.resolveLinkedFile(href)
+	if !ok {
+		return match
+	}
+
+	filename, err := h.attachFile(path)
+	if err != nil {
+		fmt.Fprintf(h.out, "⚠️ 警告: 附件上传失败 %s: %v\n", path, err)
+		return match
+	}
+
+	reference := h.attachmentReference(filename)
+	if h.attachmentsConfig.ViewFile && viewFileExtensions[strings.ToLower(filepath.Ext(filename))] {
+		return `<ac:structured-macro ac:name="view-file"><ac:parameter ac:name="name">` + reference + `</ac:parameter></ac:structured-macro>`
+	}
+	return `<ac:link>` + reference + linkBody(inner) + `</ac:link>`
+}
+
+// resolveLinkedFile 解析链接指向的本地文件
+// 外部链接、页内锚点、站点内绝对路径、Markdown文档以及Markdown文件所在目录之外的文件不作处理
+// 参数:
+//   - href: 链接地址
+// 返回:
+//   - string: 本地文件路径
+//   - bool: 是否为存在的本地文件
+func (h *ImageHandler) resolveLinkedFile(href string) (string, bool) {
+	if href == "" || isRemoteOrAbsolute(href) || strings.Contains(href, ":") {
+		return "", false
+	}
+
+	// 去掉查询参数与锚点
+	if idx := strings.IndexAny(href, "?#"); idx >= 0 {
+		href = href[:idx]
+	}
+	if unescaped, err := url.PathUnescape(href); err == nil {
+		href = unescaped
+	}
+
+	switch strings.ToLower(filepath.Ext(href)) {
+	case "", ".md", ".markdown":
+		return "", false
+	}
+
+	root, err := filepath.Abs(h.markdownDir)
+	if err != nil {
+		return "", false
+	}
+	path := filepath.Join(root, filepath.FromSlash(href))
+	if rel, err := filepath.Rel(root, path); err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		fmt.Fprintf(h.out, "⚠️ 警告: 链接的文件 %s 不在Markdown文件所在目录中，保留原链接\n", href)
+		return "", false
+	}
+	info, err := os.Stat(path)
+	if err != nil || !info.Mode().IsRegular() {
+		return "", false
+	}
+	return path, true
+}
+
+// attachFile 上传本地文件为当前页面的附件，离线模式下只分配附件名
+// 参数:
+//   - path: 本地文件路径
+// 返回:
+//   - string: 附件文件名
+//   - error: 读取或上传失败时的错误
+func (h *ImageHandler) attachFile(path string) (string, error) {
+	source := h.attachmentSource(path)
+	if h.dryRun {
+		return h.attachmentName(filepath.Base(path), source), nil
+	}
+
+	contentType := mime.TypeByExtension(filepath.Ext(path))
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	return h.uploadLocalFile(path, contentType)
+}
@@ -0,0 +1,227 @@
+package markdown
+
+import (
+	"bytes"
+	"strings"
+
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/renderer"
+	"github.com/yuin/goldmark/util"
+)
+
+// codeLanguageAliases 常见语言名到Confluence代码宏支持语言的映射
+var codeLanguageAliases = map[string]string{
+	"actionscript": "actionscript3",
+	"as3":          "actionscript3",
+	"sh":           "bash",
+	"shell":        "bash",
+	"zsh":          "bash",
+	"console":      "bash",
+	"c#":           "csharp",
+	"cs":           "csharp",
+	"c":            "cpp",
+	"c++":          "cpp",
+	"cc":           "cpp",
+	"h":            "cpp",
+	"hpp":          "cpp",
+	"cfm":          "coldfusion",
+	"pas":          "delphi",
+	"pascal":       "delphi",
+	"patch":        "diff",
+	"erl":          "erlang",
+	"golang":       "go",
+	"kt":           "kotlin",
+	"kts":          "kotlin",
+	"rs":           "rust",
+	"objc":         "objective-c",
+	"objectivec":   "objective-c",
+	"html":         "xml",
+	"htm":          "xml",
+	"xhtml":        "xml",
+	"svg":          "xml",
+	"js":           "javascript",
+	"jsx":          "javascript",
+	"ts":           "javascript",
+	"tsx":          "javascript",
+	"typescript":   "javascript",
+	"node":         "javascript",
+	"json":         "javascript",
+	"pl":           "perl",
+	"ps1":          "powershell",
+	"pwsh":         "powershell",
+	"py":           "python",
+	"python3":      "python",
+	"rb":           "ruby",
+	"scss":         "sass",
+	"vbnet":        "vb",
+	"yml":          "yaml",
+	"plain":        "text",
+	"plaintext":    "text",
+	"txt":          "text",
+}
+
+// codeLanguages Confluence代码宏支持的语言
+// go、kotlin、rust 等较新的语言由 Confluence Cloud 与新版 Data Center 支持，
+// 旧版本可通过 language_aliases 映射为其他语言
+var codeLanguages = map[string]bool{
+	"actionscript3": true, "applescript": true, "bash": true, "csharp": true,
+	"coldfusion": true, "cpp": true, "css": true, "delphi": true, "diff": true,
+	"erlang": true, "groovy": true, "java": true, "javafx": true, "javascript": true,
+	"perl": true, "php": true, "powershell": true, "python": true, "ruby": true,
+	"sass": true, "scala": true, "sql": true, "text": true, "vb": true, "xml": true,
+	"yaml": true, "go": true, "kotlin": true, "rust": true, "swift": true,
+	"objective-c": true, "r": true, "lua": true, "dart": true, "haskell": true,
+	"matlab": true,
+}
+
+// normalizeCodeLanguage 将代码块语言规范化为Confluence支持的语言
+// 参数:
+//   - language: 代码块语言
+//
+// 返回:
+//   - string: Confluence支持的语言，不支持时返回回退语言
+func (ch *ContentHandler) normalizeCodeLanguage(language string) string {
+	language = strings.ToLower(strings.TrimSpace(language))
+
+	if alias, ok := ch.codeBlock.LanguageAliases[language]; ok {
+		return alias
+	}
+	if alias, ok := codeLanguageAliases[language]; ok {
+		language = alias
+	}
+	if codeLanguages[language] {
+		return language
+	}
+
+	if ch.codeBlock.FallbackLanguage != "" {
+		return ch.codeBlock.FallbackLanguage
+	}
+	return "text"
+}
+
+// parseCodeInfo 解析围栏代码块语言之后的信息字符串
+// 支持: title="main.go" linenos collapse theme=Midnight firstline=10
+// Confluence代码宏不支持高亮行，{3-5} 这类标记会被忽略
+// 参数:
+//   - info: 信息字符串（不含语言）
+//
+// 返回:
+//   - map[string]string: Confluence代码宏参数
+func parseCodeInfo(info string) map[string]string {
+	params := make(map[string]string)
+
+	for _, token := range splitCodeInfo(info) {
+		if strings.HasPrefix(token, "{") && strings.HasSuffix(token, "}") {
+			continue
+		}
+
+		key, value, hasValue := strings.Cut(token, "=")
+		key = strings.ToLower(strings.TrimSpace(key))
+		value = strings.Trim(strings.TrimSpace(value), `"'`)
+
+		switch key {
+		case "title":
+			params["title"] = value
+		case "linenos", "linenumbers", "line-numbers", "showlinenumbers":
+			params["linenumbers"] = boolOption(value, hasValue)
+		case "collapse", "collapsed":
+			params["collapse"] = boolOption(value, hasValue)
+		case "theme":
+			params["theme"] = value
+		case "firstline", "start", "startline":
+			params["firstline"] = value
+			if _, ok := params["linenumbers"]; !ok {
+				params["linenumbers"] = "true"
+			}
+		}
+	}
+
+	return params
+}
+
+// splitCodeInfo 按空白拆分信息字符串，保留引号和花括号内的空白
+func splitCodeInfo(info string) []string {
+	var tokens []string
+	var current strings.Builder
+	var quote rune
+	braces := 0
+
+	for _, r := range info {
+		switch {
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			}
+		case r == '"' || r == '\'':
+			quote = r
+		case r == '{':
+			braces++
+		case r == '}':
+			braces--
+		case (r == ' ' || r == '\t') && braces <= 0:
+			if current.Len() > 0 {
+				tokens = append(tokens, current.String())
+				current.Reset()
+			}
+			continue
+		}
+		current.WriteRune(r)
+	}
+	if current.Len() > 0 {
+		tokens = append(tokens, current.String())
+	}
+
+	return tokens
+}
+
+// boolOption 将可选值的开关解析为 "true"/"false"
+func boolOption(value string, hasValue bool) string {
+	if !hasValue {
+		return "true"
+	}
+	switch strings.ToLower(value) {
+	case "false", "no", "off", "0":
+		return "false"
+	}
+	return "true"
+}
+
+// codeBlockRenderer 渲染围栏代码块，并通过 data-info 属性保留语言之后的信息字符串
+type codeBlockRenderer struct{}
+
+// RegisterFuncs 实现 renderer.NodeRenderer
+func (r *codeBlockRenderer) RegisterFuncs(reg renderer.NodeRendererFuncRegisterer) {
+	reg.Register(ast.KindFencedCodeBlock, r.renderFencedCodeBlock)
+}
+
+func (r *codeBlockRenderer) renderFencedCodeBlock(w util.BufWriter, source []byte, node ast.Node, entering bool) (ast.WalkStatus, error) {
+	n := node.(*ast.FencedCodeBlock)
+	if !entering {
+		_, _ = w.WriteString("</code></pre>\n")
+		return ast.WalkContinue, nil
+	}
+
+	_, _ = w.WriteString("<pre><code")
+	language := n.Language(source)
+	if language != nil {
+		_, _ = w.WriteString(` class="language-`)
+		_, _ = w.Write(util.EscapeHTML(language))
+		_, _ = w.WriteString(`"`)
+
+		info := n.Info.Segment.Value(source)
+		if rest := bytes.TrimSpace(info[len(language):]); len(rest) > 0 {
+			_, _ = w.WriteString(` data-info="`)
+			_, _ = w.Write(util.EscapeHTML(rest))
+			_, _ = w.WriteString(`"`)
+		}
+	}
+	_ = w.WriteByte('>')
+
+	lines := n.Lines()
+	for i := 0; i < lines.Len(); i++ {
+		line := lines.At(i)
+		_, _ = w.Write(util.EscapeHTML(line.Value(source)))
+	}
+
+	return ast.WalkContinue, nil
+}
@@ -1,47 +1,173 @@
 package markdown
 
 import (
+    "fmt"
+    "html"
+    "io"
+    "os"
     "regexp"
+    "sort"
     "strconv"
     "strings"
 
+    "github.com/HelloAnner/markdown-sync-confluence/pkg/config"
+    "github.com/HelloAnner/markdown-sync-confluence/pkg/confluence"
     "github.com/yuin/goldmark"
     "github.com/yuin/goldmark/extension"
     "github.com/yuin/goldmark/parser"
-    "github.com/yuin/goldmark/renderer/html"
+    "github.com/yuin/goldmark/renderer"
+    gmhtml "github.com/yuin/goldmark/renderer/html"
+    "github.com/yuin/goldmark/util"
+    "gopkg.in/yaml.v3"
 )
 
 // ContentHandler 处理Markdown内容并将其转换为Confluence格式
 type ContentHandler struct {
 	markdown          goldmark.Markdown    // Markdown解析器
 	imagePlaceholders map[string]string    // 图片占位符映射
+	codeMacros        []config.CodeMacroConfig // 代码块语言到宏的映射
+	codeBlock         config.CodeBlockConfig   // 代码宏默认选项
+	toc               config.TOCConfig         // 目录宏配置
+	footnotes         config.FootnotesConfig   // 脚注配置
+	frontMatter       map[string]interface{}   // 当前文档的front matter
+	labels            []string                 // 当前文档的标签（Obsidian兼容模式）
+	users             *userDirectory           // @提及用户解析
+	pipeline          *Pipeline                // 转换流水线
+	out               io.Writer                // 警告信息的输出
+	configErr         error                    // 构造时发现的配置问题，首次转换时提示
 }
 
 // NewContentHandler 创建一个新的内容处理器
+// 参数:
+//   - cfg: 应用配置（为nil时使用默认设置）
 // 返回:
 //   - *ContentHandler: 内容处理器实例
-func NewContentHandler() *ContentHandler {
+func NewContentHandler(cfg *config.Config) *ContentHandler {
+	if cfg == nil {
+		cfg = &config.Config{}
+	}
+
 	// 配置Goldmark，启用所需扩展
+	extensions := []goldmark.Extender{
+		extension.GFM,           // GitHub风格Markdown支持
+		extension.Footnote,      // 脚注支持
+		extension.Table,         // 表格支持
+		&statusExtension{},      // 状态标签
+	}
+	if !cfg.Markdown.Math.Disabled {
+		extensions = append(extensions, &mathExtension{config: cfg.Markdown.Math}) // LaTeX公式支持
+	}
+	if !cfg.Markdown.Emoji.Disabled {
+		extensions = append(extensions, &emojiExtension{}) // 表情短代码
+	}
+	var configErr error
+	if cfg.Markdown.Jira.Enabled {
+		jira, err := newJiraExtension(cfg.Markdown.Jira)
+		if err != nil {
+			configErr = fmt.Errorf("%s，仅转换 [[jira:KEY]] 引用", err)
+		}
+		extensions = append(extensions, jira) // Jira问题引用
+	}
+	if cfg.Markdown.Obsidian.Enabled {
+		extensions = append(extensions, &obsidianExtension{}) // 笔记链接与callout
+	}
+	users := &userDirectory{out: os.Stdout, config: cfg.Markdown.Mentions.Resolved(), users: make(map[string]*confluence.User)}
+	if !cfg.Markdown.Mentions.Disabled {
+		extensions = append(extensions, &mentionExtension{config: users.config}) // @提及
+	}
+
 	md := goldmark.New(
-		goldmark.WithExtensions(
-			extension.GFM,           // GitHub风格Markdown支持
-			extension.Footnote,      // 脚注支持
-			extension.Table,         // 表格支持
-		),
+		goldmark.WithExtensions(extensions...),
 		goldmark.WithParserOptions(
 			parser.WithAutoHeadingID(), // 自动生成标题ID
 		),
 		goldmark.WithRendererOptions(
-			html.WithHardWraps(),    // 启用硬换行
-			html.WithXHTML(),        // 使用XHTML格式
-			html.WithUnsafe(),       // 允许原始HTML
+			gmhtml.WithHardWraps(),  // 启用硬换行
+			gmhtml.WithXHTML(),      // 使用XHTML格式
+			gmhtml.WithUnsafe(),     // 允许原始HTML
+			renderer.WithNodeRenderers(
+				util.Prioritized(&codeBlockRenderer{}, 100), // 保留代码块信息字符串
+			),
 		),
 	)
 
-	return &ContentHandler{
+	ch := &ContentHandler{
 		markdown:          md,
 		imagePlaceholders: make(map[string]string),
+		codeMacros:        cfg.Markdown.ResolvedCodeMacros(),
+		codeBlock:         cfg.Markdown.CodeBlock,
+		toc:               cfg.Markdown.TOC,
+		footnotes:         cfg.Markdown.Footnotes,
+		users:             users,
+		pipeline:          NewPipeline(),
+		out:               os.Stdout,
+		configErr:         configErr,
+	}
+	ch.registerStages()
+	if cfg.Markdown.Obsidian.Enabled {
+		ch.pipeline.Register(StageMarkdown, 50, textStage("obsidian", ch.preProcessObsidian)) // %%注释%% 与 #标签
 	}
+	ch.pipeline.Configure(cfg.Markdown.Pipeline)
+	return ch
+}
+
+// registerStages 注册内置的转换步骤
+// Mermaid等图表由 code-blocks 步骤按代码宏映射处理；同名的 markdown 与 storage 步骤成对工作，按名称禁用时一并禁用
+func (ch *ContentHandler) registerStages() {
+	ch.pipeline.Register(StageMarkdown, 100, textStage("folding", ch.preProcessFolding))      // 折叠块
+	ch.pipeline.Register(StageMarkdown, 200, textStage("task-lists", ch.preProcessTaskLists)) // 任务列表
+	ch.pipeline.Register(StageMarkdown, 300, textStage("toc", ch.preProcessTOCMarkers))       // 目录标记
+
+	ch.pipeline.Register(StageStorage, 100, textStage("code-blocks", ch.postProcessCodeBlocks))         // 代码块（含Mermaid等宏映射）
+	ch.pipeline.Register(StageStorage, 200, textStage("links", ch.postProcessLinks))                    // 链接
+	ch.pipeline.Register(StageStorage, 300, textStage("folding", ch.postProcessFolding))                // 折叠块
+	ch.pipeline.Register(StageStorage, 400, textStage("footnotes", ch.postProcessFootnotes))            // 脚注
+	ch.pipeline.Register(StageStorage, 500, textStage("heading-anchors", ch.postProcessHeadingAnchors)) // 标题锚点与页内链接
+	ch.pipeline.Register(StageStorage, 600, textStage("tables", ch.postProcessTables))                  // 表格
+	ch.pipeline.Register(StageStorage, 700, textStage("task-lists", ch.postProcessTaskLists))           // 任务列表
+	ch.pipeline.Register(StageStorage, 800, textStage("highlights", ch.postProcessMarkHighlights))      // <mark> 高亮
+	ch.pipeline.Register(StageStorage, 900, textStage("toc", ch.addTOCMacro))                           // 目录宏
+	ch.pipeline.Register(StageStorage, 1000, textStage("figures", ch.postProcessFigures))               // 图片标签与图片标题
+}
+
+// Pipeline 返回转换流水线，用于注册自定义步骤
+// 返回:
+//   - *Pipeline: 转换流水线
+func (ch *ContentHandler) Pipeline() *Pipeline {
+	return ch.pipeline
+}
+
+// SetFrontMatter 设置当前文档的front matter，用于覆盖文档级选项（如toc）
+// 参数:
+//   - frontMatter: 解析后的front matter
+func (ch *ContentHandler) SetFrontMatter(frontMatter map[string]interface{}) {
+	ch.frontMatter = frontMatter
+}
+
+// SetUserResolver 设置@提及的用户解析器，供 ResolveMentions 使用，未设置时按用户名引用
+// 参数:
+//   - resolver: 用户解析函数
+func (ch *ContentHandler) SetUserResolver(resolver UserResolver) {
+	ch.users.resolve = resolver
+}
+
+// SetOutput 设置警告信息的输出位置（默认为标准输出）
+// 参数:
+//   - w: 输出目标
+func (ch *ContentHandler) SetOutput(w io.Writer) {
+	ch.out = w
+	ch.users.out = w
+}
+
+// ResolveMentions 查询转换结果中提及的用户，改写为 account ID 或用户 key 引用，
+// 未找到的用户保留为文本。转换本身不访问网络，发布时在校验通过后调用
+// 参数:
+//   - content: ConvertToConfluence 生成的存储格式内容
+// 返回:
+//   - string: 处理后的内容
+//   - error: 查询用户失败时的错误
+func (ch *ContentHandler) ResolveMentions(content string) (string, error) {
+	return ch.users.resolveMentions(content)
 }
 
 // ConvertToConfluence 将Markdown内容转换为Confluence格式
@@ -51,62 +177,37 @@ func NewContentHandler() *ContentHandler {
 //   - string: 转换后的Confluence格式内容
 //   - error: 处理过程中的错误
 func (ch *ContentHandler) ConvertToConfluence(content string) (string, error) {
-	// 使用预处理器处理内容
-	content = ch.preProcessMermaid(content)    // 预处理Mermaid图表
-	content = ch.preProcessFolding(content)    // 预处理折叠块
-	content = ch.preProcessTaskLists(content)  // 预处理任务列表
+	ch.labels = nil
+	if ch.configErr != nil {
+		fmt.Fprintf(ch.out, "⚠️ 警告: %s\n", ch.configErr)
+		ch.configErr = nil
+	}
+
+	// 执行Markdown阶段的步骤
+	content, err := ch.pipeline.Run(StageMarkdown, content)
+	if err != nil {
+		return "", err
+	}
 
 	// 将Markdown转换为HTML
 	var htmlContent strings.Builder
-	if err := ch.markdown.Convert([]byte(content), &htmlContent); err != nil {
+	if err := ch.convertMarkdown(content, &htmlContent); err != nil {
 		return "", err
 	}
 
-	// 对HTML进行后处理以适配Confluence
-	result := htmlContent.String()
-	result = ch.postProcessCodeBlocks(result)  // 处理代码块
-	result = ch.postProcessLinks(result)       // 处理链接
-	result = ch.postProcessMermaid(result)     // 处理Mermaid图表
-	result = ch.postProcessFolding(result)     // 处理折叠块
-    result = ch.postProcessTables(result)      // 处理表格
-    result = ch.postProcessMarkHighlights(result) // 处理 <mark> 高亮
-    result = ch.addTOCMacro(result)            // 添加目录宏
-
-	return result, nil
+	// 执行存储格式阶段的步骤，对HTML进行后处理以适配Confluence
+	return ch.pipeline.Run(StageStorage, htmlContent.String())
 }
 
-// preProcessMermaid 处理Mermaid代码块
+// convertMarkdown 使用Goldmark将Markdown渲染为HTML，标题ID采用GitHub风格（保留中文）
 // 参数:
 //   - content: Markdown内容
+//   - w: 输出
 // 返回:
-//   - string: 预处理后的内容，其中Mermaid块被替换为占位符
-func (ch *ContentHandler) preProcessMermaid(content string) string {
-	// 保留并替换mermaid块为占位符
-	re := regexp.MustCompile("```mermaid\\s*\\n([\\s\\S]*?)```")
-	return re.ReplaceAllStringFunc(content, func(match string) string {
-		mermaidContent := re.FindStringSubmatch(match)[1]
-		return "MERMAID_PLACEHOLDER:" + mermaidContent + ":MERMAID_PLACEHOLDER"
-	})
-}
-
-// postProcessMermaid 将Mermaid占位符转换为Confluence宏
-// 参数:
-//   - content: 包含Mermaid占位符的内容
-// 返回:
-//   - string: 处理后的内容，其中占位符被替换为Confluence宏
-func (ch *ContentHandler) postProcessMermaid(content string) string {
-	// 查找所有mermaid占位符并将其转换为Confluence Markdown宏
-	re := regexp.MustCompile("MERMAID_PLACEHOLDER:([\\s\\S]*?):MERMAID_PLACEHOLDER")
-	return re.ReplaceAllStringFunc(content, func(match string) string {
-		mermaidContent := re.FindStringSubmatch(match)[1]
-		// 转义CDATA结束标记
-		mermaidContent = escapeCDATA(mermaidContent)
-		return `<ac:structured-macro ac:name="markdown">` +
-			`<ac:plain-text-body><![CDATA[` +
-			"```mermaid\n" + mermaidContent + "\n```" +
-			`]]></ac:plain-text-body>` +
-			`</ac:structured-macro>`
-	})
+//   - error: 渲染过程中的错误
+func (ch *ContentHandler) convertMarkdown(content string, w io.Writer) error {
+	ctx := parser.NewContext(parser.WithIDs(newHeadingIDs()))
+	return ch.markdown.Convert([]byte(content), w, parser.WithContext(ctx))
 }
 
 // escapeCDATA 转义内容中的CDATA结束标记序列']]>'
@@ -119,6 +220,46 @@ func escapeCDATA(content string) string {
 	return strings.ReplaceAll(content, "]]>", "]]&gt;")
 }
 
+// cdataPattern CDATA段（代码宏、纯文本链接等的原样内容）
+var cdataPattern = regexp.MustCompile(`<!\[CDATA\[[\s\S]*?\]\]>`)
+
+// replaceOutsideCDATA 只对CDATA段之外的内容应用处理函数，代码块中的原样内容保持不变
+// 参数:
+//   - content: 存储格式内容
+//   - process: 处理函数，依次作用于每段CDATA之外的内容
+// 返回:
+//   - string: 处理后的内容
+func replaceOutsideCDATA(content string, process func(string) string) string {
+	return replaceOutside(cdataPattern, content, process)
+}
+
+// literalPattern CDATA段与行内代码，其中的文本按原样显示
+var literalPattern = regexp.MustCompile(`<!\[CDATA\[[\s\S]*?\]\]>|<code(?:\s[^>]*)?>[\s\S]*?</code>`)
+
+// replaceOutsideCode 只对CDATA段与行内代码之外的内容应用处理函数
+// Goldmark 不转义行内代码中的 ![alt](path) 等语法，需要与代码块一样跳过
+// 参数:
+//   - content: 存储格式内容
+//   - process: 处理函数，依次作用于每段代码之外的内容
+// 返回:
+//   - string: 处理后的内容
+func replaceOutsideCode(content string, process func(string) string) string {
+	return replaceOutside(literalPattern, content, process)
+}
+
+// replaceOutside 只对不匹配 pattern 的内容应用处理函数
+func replaceOutside(pattern *regexp.Regexp, content string, process func(string) string) string {
+	var result strings.Builder
+	last := 0
+	for _, loc := range pattern.FindAllStringIndex(content, -1) {
+		result.WriteString(process(content[last:loc[0]]))
+		result.WriteString(content[loc[0]:loc[1]])
+		last = loc[1]
+	}
+	result.WriteString(process(content[last:]))
+	return result.String()
+}
+
 // preProcessFolding 处理折叠/可折叠部分
 // 参数:
 //   - content: Markdown内容
@@ -238,7 +379,7 @@ func (ch *ContentHandler) postProcessFolding(content string) string {
 		
 		// 将内容转换为HTML（嵌套内容需要）
 		var nestedHTML strings.Builder
-		if err := ch.markdown.Convert([]byte(foldContent), &nestedHTML); err != nil {
+		if err := ch.convertMarkdown(foldContent, &nestedHTML); err != nil {
 			return match // 错误时返回原始内容
 		}
 		
@@ -279,35 +420,61 @@ func (ch *ContentHandler) preProcessTaskLists(content string) string {
 	})
 }
 
+// postProcessTaskLists 将任务列表占位符转换为Confluence任务列表
+// 参数:
+//   - content: HTML内容
+// 返回:
+//   - string: 处理后的内容，连续的任务项合并为一个 ac:task-list
+func (ch *ContentHandler) postProcessTaskLists(content string) string {
+	reTask := regexp.MustCompile(`TASK_PLACEHOLDER_STATUS:(complete|incomplete):TEXT:(.*?):TASK_PLACEHOLDER`)
+	reRun := regexp.MustCompile(`(?:TASK_PLACEHOLDER_STATUS:.*?:TASK_PLACEHOLDER(?:<br/>)?\s*)+`)
+
+	content = reRun.ReplaceAllStringFunc(content, func(run string) string {
+		var tasks strings.Builder
+		for _, task := range reTask.FindAllStringSubmatch(run, -1) {
+			tasks.WriteString(`<ac:task><ac:task-status>` + task[1] + `</ac:task-status><ac:task-body>` + task[2] + `</ac:task-body></ac:task>`)
+		}
+		// 任务列表不能位于段落中，拆开所在的段落
+		return "</p>\n<ac:task-list>" + tasks.String() + "</ac:task-list>\n<p>"
+	})
+
+	// 移除拆分段落后留下的空段落与段尾换行
+	content = regexp.MustCompile(`<br/>\s*</p>`).ReplaceAllString(content, "</p>")
+	content = regexp.MustCompile(`<p>\s*</p>\n?`).ReplaceAllString(content, "")
+	return content
+}
+
 // postProcessCodeBlocks 将代码块转换为Confluence代码宏
 // 参数:
 //   - content: HTML内容
 // 返回:
 //   - string: 处理后的内容，其中代码块被替换为Confluence宏
 func (ch *ContentHandler) postProcessCodeBlocks(content string) string {
-	// 查找带有语言规范的代码块
-	re := regexp.MustCompile(`<pre><code class="language-([^"]+)">([\s\S]*?)</code></pre>`)
+	// 查找带有语言规范的代码块（data-info 为语言之后的信息字符串）
+	re := regexp.MustCompile(`<pre><code class="language-([^"]+)"(?: data-info="([^"]*)")?>([\s\S]*?)</code></pre>`)
 	content = re.ReplaceAllStringFunc(content, func(match string) string {
 		submatches := re.FindStringSubmatch(match)
-		if len(submatches) < 3 {
+		if len(submatches) < 4 {
 			return match
 		}
 		
 		language := submatches[1]
-		code := submatches[2]
+		options := parseCodeInfo(html.UnescapeString(submatches[2]))
+		code := submatches[3]
 		
 		// 在代码中取消转义HTML实体
 		code = strings.ReplaceAll(code, "&lt;", "<")
 		code = strings.ReplaceAll(code, "&gt;", ">")
+		code = strings.ReplaceAll(code, "&quot;", "\"")
 		code = strings.ReplaceAll(code, "&amp;", "&")
 		
-		// 转义CDATA结束标记
-		code = escapeCDATA(code)
+		// 按配置映射为指定的宏（如mermaid、plantuml）
+		if mapping, ok := ch.findCodeMacro(language); ok {
+			return ch.renderCodeMacro(mapping, code, options)
+		}
 		
-		return `<ac:structured-macro ac:name="code">` +
-			`<ac:parameter ac:name="language">` + language + `</ac:parameter>` +
-			`<ac:plain-text-body><![CDATA[` + code + `]]></ac:plain-text-body>` +
-			`</ac:structured-macro>`
+		options["language"] = ch.normalizeCodeLanguage(language)
+		return ch.renderCodeMacro(config.CodeMacroConfig{Macro: "code"}, code, options)
 	})
 	
 	// 查找没有语言规范的代码块
@@ -323,19 +490,114 @@ func (ch *ContentHandler) postProcessCodeBlocks(content string) string {
 		// 在代码中取消转义HTML实体
 		code = strings.ReplaceAll(code, "&lt;", "<")
 		code = strings.ReplaceAll(code, "&gt;", ">")
+		code = strings.ReplaceAll(code, "&quot;", "\"")
 		code = strings.ReplaceAll(code, "&amp;", "&")
 		
-		// 转义CDATA结束标记
-		code = escapeCDATA(code)
-		
-		return `<ac:structured-macro ac:name="code">` +
-			`<ac:plain-text-body><![CDATA[` + code + `]]></ac:plain-text-body>` +
-			`</ac:structured-macro>`
+		return ch.renderCodeMacro(config.CodeMacroConfig{Macro: "code"}, code, map[string]string{})
 	})
 	
 	return content
 }
 
+// findCodeMacro 查找代码块语言对应的宏映射
+// 参数:
+//   - language: 代码块语言
+// 返回:
+//   - config.CodeMacroConfig: 宏映射
+//   - bool: 是否找到
+func (ch *ContentHandler) findCodeMacro(language string) (config.CodeMacroConfig, bool) {
+	language = strings.ToLower(language)
+	for _, mapping := range ch.codeMacros {
+		if mapping.Language == language {
+			return mapping, true
+		}
+	}
+	return config.CodeMacroConfig{}, false
+}
+
+// renderCodeMacro 按映射将代码块渲染为Confluence宏
+// 参数:
+//   - mapping: 宏映射
+//   - code: 已取消HTML转义的代码内容
+//   - options: 信息字符串中的代码宏选项（仅对code宏生效）
+// 返回:
+//   - string: Confluence宏
+func (ch *ContentHandler) renderCodeMacro(mapping config.CodeMacroConfig, code string, options map[string]string) string {
+	params := make(map[string]string)
+	if mapping.Macro == "code" {
+		// 默认选项 < 信息字符串选项 < 映射中的固定参数
+		if ch.codeBlock.Theme != "" {
+			params["theme"] = ch.codeBlock.Theme
+		}
+		if ch.codeBlock.LineNumbers {
+			params["linenumbers"] = "true"
+		}
+		for name, value := range options {
+			params[name] = value
+		}
+	}
+	for name, value := range mapping.Parameters {
+		params[name] = value
+	}
+
+	body := ""
+	switch mapping.Body {
+	case config.CodeMacroBodyNone:
+		// 代码中的 key=value 或 key: value 行作为宏参数
+		for _, line := range strings.Split(code, "\n") {
+			line = strings.TrimSpace(line)
+			if line == "" || strings.HasPrefix(line, "#") {
+				continue
+			}
+			sep := strings.IndexAny(line, "=:")
+			if sep <= 0 {
+				continue
+			}
+			params[strings.TrimSpace(line[:sep])] = strings.TrimSpace(line[sep+1:])
+		}
+	case config.CodeMacroBodyFenced:
+		body = plainTextBody("```" + mapping.Language + "\n" + strings.TrimRight(code, "\n") + "\n```")
+	default:
+		body = plainTextBody(code)
+	}
+
+	return buildMacro(mapping.Macro, params, body)
+}
+
+// buildMacro 构建Confluence结构化宏，参数按名称排序以保证输出稳定
+// 参数:
+//   - name: 宏名称
+//   - params: 宏参数
+//   - body: 宏正文（已格式化的XML片段）
+// 返回:
+//   - string: Confluence宏
+func buildMacro(name string, params map[string]string, body string) string {
+	names := make([]string, 0, len(params))
+	for paramName := range params {
+		names = append(names, paramName)
+	}
+	sort.Strings(names)
+
+	var sb strings.Builder
+	sb.WriteString(`<ac:structured-macro ac:name="` + escapeXMLAttributeValue(name) + `">`)
+	for _, paramName := range names {
+		sb.WriteString(`<ac:parameter ac:name="` + escapeXMLAttributeValue(paramName) + `">` +
+			escapeXMLAttributeValue(params[paramName]) + `</ac:parameter>`)
+	}
+	sb.WriteString(body)
+	sb.WriteString(`</ac:structured-macro>`)
+	return sb.String()
+}
+
+// plainTextBody 构建宏的纯文本正文
+// 参数:
+//   - content: 正文内容
+// 返回:
+//   - string: ac:plain-text-body 元素
+func plainTextBody(content string) string {
+	return "<ac:plain-text-body><![CDATA[" + escapeCDATA(content) + "]]></ac:plain-text-body>"
+}
+
 // postProcessLinks 处理链接中的特殊属性
 // 参数:
 //   - content: HTML内容
@@ -362,6 +624,14 @@ func (ch *ContentHandler) postProcessLinks(content string) string {
 // 返回:
 //   - string: 处理后的内容，其中表格HTML被修复
 func (ch *ContentHandler) postProcessTables(content string) string {
+	// Confluence 不支持 align 属性，将 GFM 的列对齐转换为单元格样式
+	content = regexp.MustCompile(`<(th|td)([^>]*?) align="(left|center|right)"`).ReplaceAllString(content, `<$1$2 style="text-align: $3;"`)
+
+	// Confluence 的表格只有 tbody，表头行合并到 tbody 中
+	content = regexp.MustCompile(`</thead>\s*<tbody>`).ReplaceAllString(content, "")
+	content = regexp.MustCompile(`<thead>`).ReplaceAllString(content, "<tbody>")
+	content = regexp.MustCompile(`</thead>`).ReplaceAllString(content, "</tbody>")
+
 	// 确保所有表格都有tbody
 	content = regexp.MustCompile(`<table>\s*<tr>`).ReplaceAllString(content, "<table><tbody><tr>")
 	content = regexp.MustCompile(`</tr>\s*</table>`).ReplaceAllString(content, "</tr></tbody></table>")
@@ -372,20 +642,97 @@ func (ch *ContentHandler) postProcessTables(content string) string {
 	return content
 }
 
+// preProcessTOCMarkers 将独占一行的 [TOC] / [[toc]] 标记替换为占位符
+// 参数:
+//   - content: Markdown内容
+// 返回:
+//   - string: 预处理后的内容
+func (ch *ContentHandler) preProcessTOCMarkers(content string) string {
+	lines := strings.Split(content, "\n")
+	inCode := codeFenceMask(lines)
+	reMarker := regexp.MustCompile(`(?i)^\s*(?:\[TOC\]|\[\[_?TOC_?\]\])\s*$`)
+
+	for i, line := range lines {
+		if !inCode[i] && reMarker.MatchString(line) {
+			lines[i] = "\nTOC_PLACEHOLDER\n"
+		}
+	}
+
+	return strings.Join(lines, "\n")
+}
+
 // addTOCMacro 添加目录宏（如果需要）
 // 参数:
 //   - content: HTML内容
 // 返回:
-//   - string: 处理后的内容，如果需要会添加目录宏
+//   - string: 处理后的内容，目录宏放在[TOC]标记处，或按模式插入页首
 func (ch *ContentHandler) addTOCMacro(content string) string {
-		tocMacro := `<ac:structured-macro ac:name="toc">` +
-				`<ac:parameter ac:name="printable">true</ac:parameter>` +
-				`<ac:parameter ac:name="style">disc</ac:parameter>` +
-				`<ac:parameter ac:name="maxLevel">3</ac:parameter>` +
-				`<ac:parameter ac:name="minLevel">1</ac:parameter>` +
-				`</ac:structured-macro>`
-	
-    return tocMacro + "\n" + content
+	toc := ch.resolveTOC()
+	reMarker := regexp.MustCompile(`<p>TOC_PLACEHOLDER</p>\n?`)
+
+	if toc.Mode == config.TOCModeOff {
+		return reMarker.ReplaceAllString(content, "")
+	}
+
+	tocMacro := buildMacro("toc", map[string]string{
+		"printable": "true",
+		"style":     toc.Style,
+		"maxLevel":  strconv.Itoa(toc.MaxLevel),
+		"minLevel":  strconv.Itoa(toc.MinLevel),
+	}, "")
+
+	// 文档中有显式标记时，只在标记处插入
+	if reMarker.MatchString(content) {
+		return reMarker.ReplaceAllLiteralString(content, tocMacro+"\n")
+	}
+
+	if toc.Mode == config.TOCModeAuto {
+		headings := 0
+		for _, m := range regexp.MustCompile(`<h([1-6])[\s>]`).FindAllStringSubmatch(content, -1) {
+			level, _ := strconv.Atoi(m[1])
+			if level >= toc.MinLevel && level <= toc.MaxLevel {
+				headings++
+			}
+		}
+		if headings < toc.MinHeadings {
+			return content
+		}
+	}
+
+	return tocMacro + "\n" + content
+}
+
+// resolveTOC 合并配置与front matter中的目录选项
+// front matter 支持 toc: false | true | auto | off | always，或包含 mode、min_headings、
+// min_level、max_level、style 的对象；无法识别的模式提示后按 always 处理
+// 返回:
+//   - config.TOCConfig: 生效的目录配置
+func (ch *ContentHandler) resolveTOC() config.TOCConfig {
+	toc := ch.toc
+
+	switch value := ch.frontMatter["toc"].(type) {
+	case bool:
+		toc.Mode = config.TOCModeOff
+		if value {
+			toc.Mode = config.TOCModeAlways
+		}
+	case string:
+		toc.Mode = strings.ToLower(strings.TrimSpace(value))
+	case map[string]interface{}:
+		data, err := yaml.Marshal(value)
+		if err == nil {
+			_ = yaml.Unmarshal(data, &toc)
+		}
+	}
+
+	toc = toc.Resolved()
+	switch toc.Mode {
+	case config.TOCModeAuto, config.TOCModeAlways, config.TOCModeOff:
+	default:
+		fmt.Fprintf(ch.out, "⚠️ 警告: 未知的目录模式 %q，可选 auto、always、off，按 always 处理\n", toc.Mode)
+		toc.Mode = config.TOCModeAlways
+	}
+	return toc
 }
 
 // postProcessMarkHighlights 将 HTML <mark style="background: ...">text</mark>
@@ -0,0 +1,304 @@
+package markdown
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/HelloAnner/markdown-sync-confluence/pkg/config"
+	"github.com/HelloAnner/markdown-sync-confluence/pkg/confluence"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCodeMacroMapping(t *testing.T) {
+	cfg := &config.Config{
+		Markdown: config.MarkdownConfig{
+			CodeMacros: []config.CodeMacroConfig{
+				{Language: "plantuml", Macro: "plantuml"},
+				{Language: "jira", Macro: "jira", Body: config.CodeMacroBodyNone, Parameters: map[string]string{"server": "Jira"}},
+			},
+		},
+	}
+	handler := NewContentHandler(cfg)
+
+	result, err := handler.ConvertToConfluence("```plantuml\nA -> B\n```\n\n```jira\njqlQuery=project = X\n```\n\n```mermaid\ngraph TD\n```\n")
+	assert.NoError(t, err)
+	assert.Contains(t, result, `<ac:structured-macro ac:name="plantuml"><ac:plain-text-body><![CDATA[A -> B`)
+	assert.Contains(t, result, `<ac:structured-macro ac:name="jira"><ac:parameter ac:name="jqlQuery">project = X</ac:parameter><ac:parameter ac:name="server">Jira</ac:parameter></ac:structured-macro>`)
+	assert.Contains(t, result, "<ac:structured-macro ac:name=\"markdown\"><ac:plain-text-body><![CDATA[```mermaid\ngraph TD\n```]]>")
+}
+
+func TestCodeBlockOptions(t *testing.T) {
+	handler := NewContentHandler(nil)
+
+	result, err := handler.ConvertToConfluence("```py title=\"main.py\" linenos collapse {3-5}\nprint(1)\n```\n\n```brainfuck\n+\n```\n\n```golang\nfunc main() {}\n```\n")
+	assert.NoError(t, err)
+	assert.NotContains(t, result, `ac:name="highlight"`)
+	assert.Contains(t, result, `<ac:parameter ac:name="language">go</ac:parameter>`)
+	assert.Contains(t, result, `<ac:structured-macro ac:name="code">`+
+		`<ac:parameter ac:name="collapse">true</ac:parameter>`+
+		`<ac:parameter ac:name="language">python</ac:parameter>`+
+		`<ac:parameter ac:name="linenumbers">true</ac:parameter>`+
+		`<ac:parameter ac:name="title">main.py</ac:parameter>`)
+	assert.Contains(t, result, `<ac:parameter ac:name="language">text</ac:parameter><ac:plain-text-body><![CDATA[+`)
+}
+
+func TestMath(t *testing.T) {
+	handler := NewContentHandler(nil)
+
+	result, err := handler.ConvertToConfluence("Euler $e^{i\\pi}+1=0$ costs $5 and $10.\n\n$$\nx_1 * y_2\n$$\n")
+	assert.NoError(t, err)
+	assert.Contains(t, result, `<ac:structured-macro ac:name="mathinline"><ac:parameter ac:name="body">e^{i\pi}+1=0</ac:parameter></ac:structured-macro> costs $5 and $10.`)
+	assert.Contains(t, result, `<ac:structured-macro ac:name="mathblock"><ac:plain-text-body><![CDATA[x_1 * y_2]]></ac:plain-text-body></ac:structured-macro>`)
+}
+
+func TestTOCMacro(t *testing.T) {
+	handler := NewContentHandler(nil)
+	var out bytes.Buffer
+	handler.SetOutput(&out)
+
+	// 默认总是在页首插入目录
+	result, err := handler.ConvertToConfluence("# A\n\ntext\n")
+	assert.NoError(t, err)
+	assert.True(t, strings.HasPrefix(result, `<ac:structured-macro ac:name="toc">`))
+
+	// auto 模式下标题不足时不插入目录
+	handler.SetFrontMatter(map[string]interface{}{"toc": "auto"})
+	result, err = handler.ConvertToConfluence("# A\n\ntext\n")
+	assert.NoError(t, err)
+	assert.NotContains(t, result, `ac:name="toc"`)
+
+	// 无法识别的模式提示后按 always 处理
+	handler.SetFrontMatter(map[string]interface{}{"toc": "yes"})
+	result, err = handler.ConvertToConfluence("# A\n\ntext\n")
+	assert.NoError(t, err)
+	assert.Contains(t, result, `ac:name="toc"`)
+	assert.Contains(t, out.String(), `未知的目录模式 "yes"`)
+
+	// 显式标记决定插入位置，front matter 覆盖层级
+	handler.SetFrontMatter(map[string]interface{}{"toc": map[string]interface{}{"max_level": 2}})
+	result, err = handler.ConvertToConfluence("# A\n\n[[toc]]\n\n## B\n")
+	assert.NoError(t, err)
+	assert.Contains(t, result, `<h1>A</h1>`+"\n"+`<ac:structured-macro ac:name="toc"><ac:parameter ac:name="maxLevel">2</ac:parameter>`)
+
+	handler.SetFrontMatter(map[string]interface{}{"toc": false})
+	result, err = handler.ConvertToConfluence("# A\n\n[TOC]\n\n## B\n\n### C\n")
+	assert.NoError(t, err)
+	assert.NotContains(t, result, `ac:name="toc"`)
+	assert.NotContains(t, result, "TOC_PLACEHOLDER")
+}
+
+func TestHeadingAnchors(t *testing.T) {
+	handler := NewContentHandler(nil)
+
+	result, err := handler.ConvertToConfluence("# 安装说明\n\n## Installation Guide\n\nSee [guide](#installation-guide) and [中文](#安装说明).\n")
+	assert.NoError(t, err)
+	assert.Contains(t, result, "<h1>安装说明</h1>")
+	assert.Contains(t, result, `<ac:link ac:anchor="InstallationGuide"><ac:plain-text-link-body><![CDATA[guide]]></ac:plain-text-link-body></ac:link>`)
+	assert.Contains(t, result, `<ac:link ac:anchor="安装说明"><ac:plain-text-link-body><![CDATA[中文]]></ac:plain-text-link-body></ac:link>`)
+
+	// 代码块中的HTML原样保留
+	result, err = handler.ConvertToConfluence("```html\n<h2 id=\"top\">Top</h2>\n<a name=\"x\"></a>\n<a href=\"#top\">back</a>\n```\n")
+	assert.NoError(t, err)
+	assert.Contains(t, result, "<![CDATA[<h2 id=\"top\">Top</h2>\n<a name=\"x\"></a>\n<a href=\"#top\">back</a>\n]]>")
+	assert.NotContains(t, result, "ac:link")
+}
+
+func TestFootnotes(t *testing.T) {
+	handler := NewContentHandler(nil)
+
+	result, err := handler.ConvertToConfluence("Text[^a].\n\n[^a]: Note.\n")
+	assert.NoError(t, err)
+	assert.Contains(t, result, `<sup><ac:structured-macro ac:name="anchor"><ac:parameter ac:name="">fnref-1</ac:parameter></ac:structured-macro>`+
+		`<ac:link ac:anchor="fn-1"><ac:plain-text-link-body><![CDATA[1]]></ac:plain-text-link-body></ac:link></sup>`)
+	assert.Contains(t, result, "<hr/>\n<p><strong>Notes</strong></p>\n<ol>\n<li><p>"+
+		`<ac:structured-macro ac:name="anchor"><ac:parameter ac:name="">fn-1</ac:parameter></ac:structured-macro>Note. `+
+		`<ac:link ac:anchor="fnref-1"><ac:plain-text-link-body><![CDATA[↩]]></ac:plain-text-link-body></ac:link></p></li>`)
+	assert.NotContains(t, result, "footnote-backref")
+
+	// 包含列表的脚注，返回链接放在整个脚注之后
+	result, err = handler.ConvertToConfluence("Text[^1].\n\n[^1]: note\n\n    1. one\n    2. two\n")
+	assert.NoError(t, err)
+	assert.Contains(t, result, "<ol>\n<li><p>"+
+		`<ac:structured-macro ac:name="anchor"><ac:parameter ac:name="">fn-1</ac:parameter></ac:structured-macro>note</p>`+"\n"+
+		"<ol>\n<li>one</li>\n<li>two</li>\n</ol> "+
+		`<ac:link ac:anchor="fnref-1"><ac:plain-text-link-body><![CDATA[↩]]></ac:plain-text-link-body></ac:link></li>`)
+	assert.NotContains(t, result, "fnref:1")
+	assert.NoError(t, ValidateStorage(result, ""))
+}
+
+func TestTables(t *testing.T) {
+	handler := NewContentHandler(nil)
+
+	result, err := handler.ConvertToConfluence("| A | B |\n|:--|:-:|\n| **b** | `x \\| y` |\n")
+	assert.NoError(t, err)
+	assert.NotContains(t, result, "<thead>")
+	assert.Contains(t, result, `<th style="text-align: left;">A</th>`)
+	assert.Contains(t, result, `<td style="text-align: center;"><code>x | y</code></td>`)
+	assert.Contains(t, result, `<td style="text-align: left;"><strong>b</strong></td>`)
+}
+
+func TestFigures(t *testing.T) {
+	handler := NewContentHandler(nil)
+
+	result, err := handler.ConvertToConfluence("![Arch](a.png)\n*Figure 1: overview*\n\n![Plain](b.png)\n*not* a caption\n")
+	assert.NoError(t, err)
+	assert.Contains(t, result, `<p><img src="a.png" alt="Arch" align="center"/></p><p style="text-align: center;"><em>Figure 1: overview</em></p>`)
+	assert.Contains(t, result, `<p><img src="b.png" alt="Plain" /><br/>`)
+
+	result, err = handler.ConvertToConfluence(`<figure><img src="c.png" alt="C" align="right"><figcaption>Chart</figcaption></figure>` + "\n\n" + `<img src="d.png" width="300">` + "\n")
+	assert.NoError(t, err)
+	assert.Contains(t, result, `<p><img src="c.png" alt="C" align="right"/></p><p style="text-align: center;"><em>Chart</em></p>`)
+	assert.Contains(t, result, `<img src="d.png" width="300"/>`)
+
+	// 代码块中的HTML保持原样
+	result, err = handler.ConvertToConfluence("```html\n<img src=\"logo.png\">\n<p><img src=\"a.png\"/>\n<em>x</em></p>\n```\n")
+	assert.NoError(t, err)
+	assert.Contains(t, result, "<![CDATA[<img src=\"logo.png\">\n<p><img src=\"a.png\"/>\n<em>x</em></p>\n]]>")
+}
+
+func TestObsidian(t *testing.T) {
+	source := "See [[Other]], [[dir/Second.md|second]], [[Third#Set Up]] and [[#Top]]. %%hidden%%#review #123 #ops/db `#no %%x%%`\n\n" +
+		"> [!warning]+ Careful\n> body\n\n> [!faq]\n> question\n\n> quote\n\n%%\nblock comment\n%%\n\n```\n%% kept %% #code\n```\n"
+
+	result, err := NewContentHandler(nil).ConvertToConfluence(source)
+	assert.NoError(t, err)
+	assert.Contains(t, result, "[[Other]]")
+
+	cfg := &config.Config{}
+	cfg.Markdown.Obsidian.Enabled = true
+	handler := NewContentHandler(cfg)
+	handler.SetFrontMatter(map[string]interface{}{"tags": []interface{}{"Draft", "review"}})
+	result, err = handler.ConvertToConfluence(source)
+	assert.NoError(t, err)
+	assert.Contains(t, result, `See <ac:link><ri:page ri:content-title="Other"/><ac:plain-text-link-body><![CDATA[Other]]></ac:plain-text-link-body></ac:link>, `+
+		`<ac:link><ri:page ri:content-title="Second"/><ac:plain-text-link-body><![CDATA[second]]></ac:plain-text-link-body></ac:link>, `+
+		`<ac:link ac:anchor="SetUp"><ri:page ri:content-title="Third"/><ac:plain-text-link-body><![CDATA[Third > Set Up]]></ac:plain-text-link-body></ac:link> and `+
+		`<ac:link ac:anchor="Top"><ac:plain-text-link-body><![CDATA[Top]]></ac:plain-text-link-body></ac:link>.`)
+	assert.Contains(t, result, `<ac:structured-macro ac:name="expand"><ac:parameter ac:name="title">Careful</ac:parameter><ac:rich-text-body><p>body</p>`)
+	assert.Contains(t, result, `<ac:structured-macro ac:name="note"><ac:rich-text-body><p>question</p>`)
+	assert.Contains(t, result, "<blockquote>\n<p>quote</p>")
+	assert.Contains(t, result, "<code>#no %%x%%</code>")
+	assert.Contains(t, result, "%% kept %% #code")
+	assert.NotContains(t, result, "hidden")
+	assert.NotContains(t, result, "block comment")
+	assert.Equal(t, []string{"draft", "review", "ops-db"}, handler.Labels())
+}
+
+func TestEmojiAndMentions(t *testing.T) {
+	handler := NewContentHandler(nil)
+	handler.SetUserResolver(func(name string) (*confluence.User, error) {
+		if name == "alice" {
+			return &confluence.User{AccountID: "5b10ac8d82e05b22cc7d4ef5"}, nil
+		}
+		return nil, nil
+	})
+
+	result, err := handler.ConvertToConfluence("Hi @alice and @nobody, mail a@b.com :smile: :unknown:\n\n`@alice :smile:`\n")
+	assert.NoError(t, err)
+	assert.Contains(t, result, `Hi <ac:link><ri:user ri:username="alice"/></ac:link>`)
+	result, err = handler.ResolveMentions(result)
+	assert.NoError(t, err)
+	assert.Contains(t, result, `Hi <ac:link><ri:user ri:account-id="5b10ac8d82e05b22cc7d4ef5"/></ac:link> and @nobody`)
+	assert.Contains(t, result, `<a href="mailto:a@b.com">a@b.com</a> <ac:emoticon ac:name="smile"/> :unknown:`)
+	assert.Contains(t, result, "<code>@alice :smile:</code>")
+
+	// 查询失败时返回错误
+	failing := NewContentHandler(nil)
+	failing.SetUserResolver(func(name string) (*confluence.User, error) {
+		return nil, errors.New("connection refused")
+	})
+	result, err = failing.ConvertToConfluence("Hi @alice\n")
+	assert.NoError(t, err)
+	_, err = failing.ResolveMentions(result)
+	assert.ErrorContains(t, err, "解析用户 alice 失败: connection refused")
+
+	cfg := &config.Config{}
+	cfg.Markdown.Mentions = config.MentionsConfig{Prefix: "@{", Suffix: "}"}
+	result, err = NewContentHandler(cfg).ConvertToConfluence("Ping @{John Smith} and @alice\n")
+	assert.NoError(t, err)
+	assert.Contains(t, result, `Ping <ac:link><ri:user ri:username="John Smith"/></ac:link> and @alice`)
+
+	// 折叠块标题不解析为表情或提及
+	result, err = handler.ConvertToConfluence("---warning---\nBe careful :smile:\n---warning---\n\n---@alice---\nbody\n---@alice---\n")
+	assert.NoError(t, err)
+	assert.Contains(t, result, `<ac:parameter ac:name="title">warning</ac:parameter><ac:rich-text-body><p>Be careful <ac:emoticon ac:name="smile"/></p>`)
+	assert.Contains(t, result, `<ac:parameter ac:name="title">@alice</ac:parameter>`)
+	assert.NotContains(t, result, "FOLD_PLACEHOLDER")
+}
+
+func TestStatus(t *testing.T) {
+	handler := NewContentHandler(nil)
+
+	result, err := handler.ConvertToConfluence("{status:green|DONE} {status:red,subtle|Blocked} {status|TODO} {status:pink|X}\n")
+	assert.NoError(t, err)
+	assert.Contains(t, result, `<ac:structured-macro ac:name="status"><ac:parameter ac:name="colour">Green</ac:parameter><ac:parameter ac:name="title">DONE</ac:parameter></ac:structured-macro>`)
+	assert.Contains(t, result, `<ac:parameter ac:name="colour">Red</ac:parameter><ac:parameter ac:name="subtle">true</ac:parameter><ac:parameter ac:name="title">Blocked</ac:parameter>`)
+	assert.Contains(t, result, `<ac:structured-macro ac:name="status"><ac:parameter ac:name="title">TODO</ac:parameter></ac:structured-macro>`)
+	assert.Contains(t, result, "{status:pink|X}")
+}
+
+func TestJiraIssues(t *testing.T) {
+	result, err := NewContentHandler(nil).ConvertToConfluence("Fix PROJ-1 and [[jira:PROJ-2]]\n")
+	assert.NoError(t, err)
+	assert.NotContains(t, result, `ac:name="jira"`)
+
+	cfg := &config.Config{}
+	cfg.Markdown.Jira = config.JiraConfig{Enabled: true, ServerID: "abc", Projects: []string{"PROJ"}}
+	result, err = NewContentHandler(cfg).ConvertToConfluence("Fix PROJ-1 and [[jira:ABC-2]], not XPROJ-3 or PROJ-4a.\n")
+	assert.NoError(t, err)
+	assert.Contains(t, result, `Fix <ac:structured-macro ac:name="jira"><ac:parameter ac:name="key">PROJ-1</ac:parameter><ac:parameter ac:name="serverId">abc</ac:parameter></ac:structured-macro> and `)
+	assert.Contains(t, result, `<ac:parameter ac:name="key">ABC-2</ac:parameter>`)
+	assert.Contains(t, result, "not XPROJ-3 or PROJ-4a.")
+}
+
+func TestPipeline(t *testing.T) {
+	handler := NewContentHandler(nil)
+	assert.Equal(t, []string{"folding", "task-lists", "toc"}, handler.Pipeline().Stages(StageMarkdown))
+
+	handler.Pipeline().Register(StageStorage, 650, NewStage("shout", func(content string) (string, error) {
+		return strings.ReplaceAll(content, "hello", "HELLO"), nil
+	}))
+	result, err := handler.ConvertToConfluence("hello\n\n- [ ] todo\n- [x] done\n")
+	assert.NoError(t, err)
+	assert.Contains(t, result, "<p>HELLO</p>")
+	assert.Contains(t, result, "<ac:task-list><ac:task><ac:task-status>incomplete</ac:task-status><ac:task-body>todo</ac:task-body></ac:task>"+
+		"<ac:task><ac:task-status>complete</ac:task-status><ac:task-body>done</ac:task-body></ac:task></ac:task-list>")
+	assert.NotContains(t, result, "TASK_PLACEHOLDER")
+
+	cfg := &config.Config{}
+	cfg.Markdown.Pipeline = config.PipelineConfig{Disabled: []string{"toc"}}
+	result, err = NewContentHandler(cfg).ConvertToConfluence("# A\n\n[TOC]\n\n## B\n\n### C\n")
+	assert.NoError(t, err)
+	assert.NotContains(t, result, `ac:name="toc"`)
+
+	handler.Pipeline().Register(StageMarkdown, 50, NewStage("fail", func(content string) (string, error) {
+		return "", errors.New("boom")
+	}))
+	_, err = handler.ConvertToConfluence("x")
+	assert.EqualError(t, err, "markdown 阶段步骤 fail 失败: boom")
+
+	// Process 保持原有签名，自定义步骤出错时只执行内置步骤
+	preprocessor := NewPreprocessor()
+	preprocessor.Pipeline().Register(StageMarkdown, 300, NewStage("fail", func(content string) (string, error) {
+		return "", errors.New("boom")
+	}))
+	_, err = preprocessor.Run("---\ntitle: A\n---\nbody\n")
+	assert.EqualError(t, err, "markdown 阶段步骤 fail 失败: boom")
+	assert.Equal(t, "body\n", preprocessor.Process("---\ntitle: A\n---\nbody\n"))
+}
+
+func TestTaskLists(t *testing.T) {
+	handler := NewContentHandler(nil)
+	handler.SetFrontMatter(map[string]interface{}{"toc": false})
+
+	// 连续的任务项合并为一个任务列表，任务列表不位于段落中
+	result, err := handler.ConvertToConfluence("Plan:\n- [ ] write **docs**\n- [x] ship\n\nThen\n\n- [ ] review\n")
+	assert.NoError(t, err)
+	assert.Equal(t, "<p>Plan:</p>\n<ac:task-list>"+
+		"<ac:task><ac:task-status>incomplete</ac:task-status><ac:task-body>write <strong>docs</strong></ac:task-body></ac:task>"+
+		"<ac:task><ac:task-status>complete</ac:task-status><ac:task-body>ship</ac:task-body></ac:task></ac:task-list>\n"+
+		"<p>Then</p>\n<ac:task-list><ac:task><ac:task-status>incomplete</ac:task-status><ac:task-body>review</ac:task-body></ac:task></ac:task-list>\n", result)
+	assert.NoError(t, ValidateStorage(result, ""))
+}
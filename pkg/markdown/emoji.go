@@ -0,0 +1,123 @@
+package markdown
+
+import (
+	"bytes"
+	"regexp"
+
+	"github.com/HelloAnner/markdown-sync-confluence/pkg/confluence"
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/parser"
+	"github.com/yuin/goldmark/renderer"
+	"github.com/yuin/goldmark/text"
+	"github.com/yuin/goldmark/util"
+)
+
+// kindEmoji 表情节点类型
+var kindEmoji = ast.NewNodeKind("Emoji")
+
+// emoji 表情短代码 :smile:
+type emoji struct {
+	ast.BaseInline
+	name string // Confluence 表情名称
+}
+
+// Kind 实现 ast.Node
+func (n *emoji) Kind() ast.NodeKind { return kindEmoji }
+
+// Dump 实现 ast.Node
+func (n *emoji) Dump(source []byte, level int) {
+	ast.DumpHelper(n, source, level, map[string]string{"Name": n.name}, nil)
+}
+
+var (
+	// foldPlaceholderPattern 预处理生成的折叠占位符
+	foldPlaceholderPattern = regexp.MustCompile(`FOLD_PLACEHOLDER_TITLE:[\s\S]*?:FOLD_PLACEHOLDER`)
+	// foldRangesKey 解析上下文中缓存的折叠占位符位置
+	foldRangesKey = parser.NewContextKey()
+)
+
+// emojiExtension 将已知的表情短代码渲染为Confluence表情
+type emojiExtension struct{}
+
+// Extend 实现 goldmark.Extender
+func (e *emojiExtension) Extend(m goldmark.Markdown) {
+	m.Parser().AddOptions(
+		parser.WithInlineParsers(util.Prioritized(&emojiParser{}, 200)),
+	)
+	m.Renderer().AddOptions(
+		renderer.WithNodeRenderers(util.Prioritized(&emojiRenderer{}, 200)),
+	)
+}
+
+// emojiParser 解析 :shortcode:，未知的短代码保持原样
+type emojiParser struct{}
+
+// Trigger 实现 parser.InlineParser
+func (p *emojiParser) Trigger() []byte {
+	return []byte{':'}
+}
+
+// Parse 实现 parser.InlineParser
+func (p *emojiParser) Parse(parent ast.Node, block text.Reader, pc parser.Context) ast.Node {
+	if inFoldPlaceholder(block, pc) {
+		return nil
+	}
+	line, _ := block.PeekLine()
+
+	end := bytes.IndexByte(line[1:], ':')
+	if end <= 0 {
+		return nil
+	}
+	shortcode := line[1 : 1+end]
+	for _, c := range shortcode {
+		if !isShortcodeChar(c) {
+			return nil
+		}
+	}
+
+	name, ok := confluence.EmoticonName(string(shortcode))
+	if !ok {
+		return nil
+	}
+	block.Advance(end + 2)
+	return &emoji{name: name}
+}
+
+// inFoldPlaceholder 判断当前位置是否位于折叠占位符中（FOLD_PLACEHOLDER_TITLE:标题:CONTENT:内容:FOLD_PLACEHOLDER），
+// 标题原样写入展开宏参数，内容在生成展开宏时再单独转换，因此其中不解析表情与提及，
+// 避免 ---warning--- 这类标题被当作短代码
+func inFoldPlaceholder(block text.Reader, pc parser.Context) bool {
+	ranges, ok := pc.Get(foldRangesKey).([][]int)
+	if !ok {
+		ranges = append([][]int{}, foldPlaceholderPattern.FindAllIndex(block.Source(), -1)...)
+		pc.Set(foldRangesKey, ranges)
+	}
+	_, segment := block.PeekLine()
+	for _, r := range ranges {
+		if segment.Start > r[0] && segment.Start < r[1] {
+			return true
+		}
+	}
+	return false
+}
+
+// isShortcodeChar 判断是否为短代码允许的字符
+func isShortcodeChar(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= '0' && c <= '9' || c == '_' || c == '+' || c == '-'
+}
+
+// emojiRenderer 将表情节点渲染为 ac:emoticon
+type emojiRenderer struct{}
+
+// RegisterFuncs 实现 renderer.NodeRenderer
+func (r *emojiRenderer) RegisterFuncs(reg renderer.NodeRendererFuncRegisterer) {
+	reg.Register(kindEmoji, r.renderEmoji)
+}
+
+func (r *emojiRenderer) renderEmoji(w util.BufWriter, source []byte, node ast.Node, entering bool) (ast.WalkStatus, error) {
+	if entering {
+		_, _ = w.WriteString(`<ac:emoticon ac:name="` + escapeXMLAttributeValue(node.(*emoji).name) + `"/>`)
+	}
+	return ast.WalkSkipChildren, nil
+}
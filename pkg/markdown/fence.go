@@ -0,0 +1,82 @@
+package markdown
+
+import (
+	"strings"
+)
+
+// codeFenceMask 标记每一行是否位于围栏代码块内（含围栏行本身）
+// 参数:
+//   - lines: Markdown内容按行拆分的结果
+// 返回:
+//   - []bool: 与lines等长，true表示该行属于代码块
+func codeFenceMask(lines []string) []bool {
+	mask := make([]bool, len(lines))
+	fence := ""
+
+	for i, line := range lines {
+		trimmed := strings.TrimLeft(line, " ")
+		indent := len(line) - len(trimmed)
+
+		if fence == "" {
+			if indent <= 3 && (strings.HasPrefix(trimmed, "```") || strings.HasPrefix(trimmed, "~~~")) {
+				fence = trimmed[:fenceLength(trimmed)]
+				mask[i] = true
+			}
+			continue
+		}
+
+		mask[i] = true
+		if indent <= 3 && strings.HasPrefix(trimmed, fence) && strings.TrimSpace(strings.TrimLeft(trimmed, fence[:1])) == "" {
+			fence = ""
+		}
+	}
+
+	return mask
+}
+
+// fenceLength 返回行首连续围栏字符的数量
+func fenceLength(line string) int {
+	n := 0
+	for n < len(line) && line[n] == line[0] {
+		n++
+	}
+	return n
+}
+
+// inlineCodeSpans 返回行内代码（由一个或多个反引号包围）在行中的位置
+// 参数:
+//   - line: Markdown中的一行
+// 返回:
+//   - [][2]int: 每段行内代码（含反引号）的起止位置
+func inlineCodeSpans(line string) [][2]int {
+	var spans [][2]int
+	for i := 0; i < len(line); {
+		if line[i] != '`' {
+			i++
+			continue
+		}
+
+		// 行内代码以相同数量的反引号结束，找不到时反引号按普通字符处理
+		n := fenceLength(line[i:])
+		end := -1
+		for j := i + n; j < len(line); {
+			if line[j] != '`' {
+				j++
+				continue
+			}
+			m := fenceLength(line[j:])
+			if m == n {
+				end = j + n
+				break
+			}
+			j += m
+		}
+		if end < 0 {
+			i += n
+			continue
+		}
+		spans = append(spans, [2]int{i, end})
+		i = end
+	}
+	return spans
+}
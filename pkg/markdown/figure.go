@@ -0,0 +1,71 @@
+package markdown
+
+import (
+	"regexp"
+	"strings"
+)
+
+var (
+	// imgTagPattern HTML <img> 标签，Markdown中直接书写的可能未自闭合
+	imgTagPattern = regexp.MustCompile(`(?i)<img\b[^>]*>`)
+	// figurePattern 带标题的 <figure>，标题可在图片之前或之后
+	figurePattern = regexp.MustCompile(`(?is)(?:<p>)?<figure[^>]*>\s*(?:<p>)?\s*(?:(<img[^>]*/>)\s*(?:</p>)?\s*(?:<p>)?\s*<figcaption[^>]*>([\s\S]*?)</figcaption>|<figcaption[^>]*>([\s\S]*?)</figcaption>\s*(?:</p>)?\s*(?:<p>)?\s*(<img[^>]*/>))\s*(?:</p>)?\s*</figure>(?:</p>)?`)
+	// captionedImagePattern 段落中单独的图片后紧跟一行强调文本
+	captionedImagePattern = regexp.MustCompile(`<p>(<img[^>]*/>)(?:<br\s*/?>)?\n<em>([^\n]*)</em></p>`)
+	// imgAlignPattern <img> 的 align 属性
+	imgAlignPattern = regexp.MustCompile(`(?i)\salign="[^"]*"`)
+)
+
+// postProcessFigures 规范化图片标签并生成图片标题
+// 直接书写的 <img> 补全为自闭合标签；<figure><figcaption> 以及图片后紧跟的强调行
+// 转为居中的图片与其下方居中的斜体标题段落（Confluence存储格式没有通用的图片标题元素）。
+// 代码块等CDATA段中的内容保持不变
+// 参数:
+//   - content: 存储格式内容
+// 返回:
+//   - string: 处理后的内容
+func (ch *ContentHandler) postProcessFigures(content string) string {
+	return replaceOutsideCDATA(content, func(part string) string {
+		part = imgTagPattern.ReplaceAllStringFunc(part, func(match string) string {
+			if strings.HasSuffix(match, "/>") {
+				return match
+			}
+			return strings.TrimSuffix(match, ">") + "/>"
+		})
+
+		part = figurePattern.ReplaceAllStringFunc(part, func(match string) string {
+			submatches := figurePattern.FindStringSubmatch(match)
+			img, caption := submatches[1], submatches[2]
+			if img == "" {
+				img, caption = submatches[4], submatches[3]
+			}
+			return captionedImage(img, caption)
+		})
+
+		return captionedImagePattern.ReplaceAllStringFunc(part, func(match string) string {
+			submatches := captionedImagePattern.FindStringSubmatch(match)
+			if strings.Contains(submatches[2], "</em>") {
+				return match // 强调的只是行内的一部分
+			}
+			return captionedImage(submatches[1], submatches[2])
+		})
+	})
+}
+
+// captionedImage 生成带标题的图片，未指定对齐方式时居中
+// 参数:
+//   - img: 自闭合的 <img> 标签
+//   - caption: 标题内容（行内HTML）
+// 返回:
+//   - string: 图片段落与标题段落
+func captionedImage(img, caption string) string {
+	if !imgAlignPattern.MatchString(img) {
+		img = strings.TrimSuffix(img, "/>")
+		img = strings.TrimRight(img, " ") + ` align="center"/>`
+	}
+	caption = strings.TrimSpace(caption)
+	if caption == "" {
+		return "<p>" + img + "</p>"
+	}
+	return `<p>` + img + `</p><p style="text-align: center;"><em>` + caption + `</em></p>`
+}
@@ -0,0 +1,119 @@
+package markdown
+
+import (
+	"regexp"
+	"strings"
+)
+
+// postProcessFootnotes 将Goldmark的脚注HTML转换为带锚点的编号"Notes"区
+// 引用处与脚注项均插入锚点宏并互相链接，去掉Confluence中显示异常的返回箭头
+// 参数:
+//   - content: HTML内容
+// 返回:
+//   - string: 处理后的内容
+func (ch *ContentHandler) postProcessFootnotes(content string) string {
+	// 1. 转换脚注引用 <sup id="fnref:1"><a href="#fn:1" ...>1</a></sup>
+	reRef := regexp.MustCompile(`<sup id="fnref(\d*):(\d+)"><a href="#fn:(\d+)"[^>]*>([^<]*)</a></sup>`)
+	content = reRef.ReplaceAllStringFunc(content, func(match string) string {
+		submatches := reRef.FindStringSubmatch(match)
+		refAnchor := footnoteRefAnchor(submatches[2], submatches[1])
+		return `<sup>` + buildMacro("anchor", map[string]string{"": refAnchor}, "") +
+			anchorLink("fn-"+submatches[3], submatches[4]) + `</sup>`
+	})
+
+	// 2. 转换脚注区
+	reSection := regexp.MustCompile(`<div class="footnotes" role="doc-endnotes">\s*<hr />\s*<ol>([\s\S]*?)</ol>\s*</div>`)
+	return reSection.ReplaceAllStringFunc(content, func(match string) string {
+		items := reSection.FindStringSubmatch(match)[1]
+
+		reBackref := regexp.MustCompile(`(?:&#160;)?<a href="#fnref\d*:\d+"[^>]*>[^<]*</a>`)
+		reIndex := regexp.MustCompile(`^<li id="fn:(\d+)">`)
+		var result strings.Builder
+		last := 0
+		for _, item := range outerElements(items, "li") {
+			submatches := reIndex.FindStringSubmatch(items[item[0]:item[1]])
+			if submatches == nil {
+				continue
+			}
+			index := submatches[1]
+			body := strings.TrimSpace(reBackref.ReplaceAllString(items[item[1]:item[2]], ""))
+
+			anchor := buildMacro("anchor", map[string]string{"": "fn-" + index}, "")
+			backlink := " " + anchorLink(footnoteRefAnchor(index, ""), "↩")
+
+			// 锚点放在第一个段落开头，返回链接放在最后一个段落末尾
+			if strings.HasPrefix(body, "<p>") {
+				body = "<p>" + anchor + strings.TrimPrefix(body, "<p>")
+			} else {
+				body = anchor + body
+			}
+			if strings.HasSuffix(body, "</p>") {
+				body = strings.TrimSuffix(body, "</p>") + backlink + "</p>"
+			} else {
+				body += backlink
+			}
+
+			result.WriteString(items[last:item[0]])
+			result.WriteString("<li>" + body + "</li>")
+			last = item[3]
+		}
+		result.WriteString(items[last:])
+		items = result.String()
+
+		return "<hr/>\n<p><strong>" + escapeXMLAttributeValue(ch.footnotesTitle()) + "</strong></p>\n<ol>" + items + "</ol>\n"
+	})
+}
+
+// outerElements 查找最外层的指定元素，嵌套的同名元素计入其父元素
+// 参数:
+//   - content: HTML内容
+//   - tag: 元素名称
+// 返回:
+//   - [][4]int: 每个元素的开始标签起止位置与结束标签起止位置
+func outerElements(content, tag string) [][4]int {
+	reTag := regexp.MustCompile(`<(/?)` + tag + `(?:\s[^>]*)?>`)
+	var elements [][4]int
+	var open [2]int
+	depth := 0
+	for _, m := range reTag.FindAllStringSubmatchIndex(content, -1) {
+		if m[3] > m[2] {
+			if depth == 0 {
+				continue
+			}
+			depth--
+			if depth == 0 {
+				elements = append(elements, [4]int{open[0], open[1], m[0], m[1]})
+			}
+			continue
+		}
+		if strings.HasSuffix(content[m[0]:m[1]], "/>") {
+			continue
+		}
+		if depth == 0 {
+			open = [2]int{m[0], m[1]}
+		}
+		depth++
+	}
+	return elements
+}
+
+// footnoteRefAnchor 返回脚注引用处的锚点名称
+// 参数:
+//   - index: 脚注序号
+//   - repeat: 同一脚注的重复引用序号（首次引用为空）
+// 返回:
+//   - string: 锚点名称
+func footnoteRefAnchor(index, repeat string) string {
+	if repeat == "" {
+		return "fnref-" + index
+	}
+	return "fnref-" + index + "-" + repeat
+}
+
+// footnotesTitle 返回脚注区标题
+func (ch *ContentHandler) footnotesTitle() string {
+	if ch.footnotes.Title != "" {
+		return ch.footnotes.Title
+	}
+	return "Notes"
+}
@@ -0,0 +1,150 @@
+package markdown
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// attachmentCache 持久化的附件缓存
+// 以页面ID和内容哈希为键记录已上传的附件及其ID与版本，重复发布时相同内容的文件只需核对附件列表，无需重新上传；
+// 同时按路径、大小和修改时间记录本地文件的哈希，未修改的文件无需重新读取。
+// 附件属于具体页面，多个页面使用同一图片时每个页面各自保存一份，页面移动或复制后仍然有效。
+type attachmentCache struct {
+	path  string
+	dirty bool
+
+	Files map[string]cachedFile                  `json:"files"` // 键为本地文件的绝对路径
+	Pages map[string]map[string]cachedAttachment `json:"pages"` // 键为页面ID，内层键为内容哈希
+}
+
+// cachedFile 本地文件的哈希记录
+type cachedFile struct {
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"mod_time"`
+	Hash    string    `json:"hash"`
+}
+
+// cachedAttachment 已上传的附件记录
+type cachedAttachment struct {
+	Filename string `json:"filename"`
+	Source   string `json:"source"`
+	ID       string `json:"id"`
+	Version  int    `json:"version"`
+}
+
+// loadAttachmentCache 从文件加载附件缓存，文件不存在或损坏时返回空缓存
+// 参数:
+//   - path: 缓存文件路径
+//   - out: 输出警告信息
+// 返回:
+//   - *attachmentCache: 附件缓存
+func loadAttachmentCache(path string, out io.Writer) *attachmentCache {
+	cache := &attachmentCache{path: path}
+	if data, err := os.ReadFile(path); err == nil {
+		if err := json.Unmarshal(data, cache); err != nil {
+			fmt.Fprintf(out, "⚠️ 警告: 附件缓存 %s 已损坏，将重新建立: %v\n", path, err)
+		}
+	}
+	if cache.Files == nil {
+		cache.Files = make(map[string]cachedFile)
+	}
+	if cache.Pages == nil {
+		cache.Pages = make(map[string]map[string]cachedAttachment)
+	}
+	return cache
+}
+
+// fileHash 返回未修改的本地文件的哈希
+// 参数:
+//   - path: 文件的绝对路径
+//   - info: 文件信息
+// 返回:
+//   - string: 内容哈希
+//   - bool: 是否命中缓存
+func (c *attachmentCache) fileHash(path string, info os.FileInfo) (string, bool) {
+	file, ok := c.Files[path]
+	if !ok || file.Size != info.Size() || !file.ModTime.Equal(info.ModTime()) {
+		return "", false
+	}
+	return file.Hash, true
+}
+
+// setFileHash 记录本地文件的哈希
+func (c *attachmentCache) setFileHash(path string, info os.FileInfo, hash string) {
+	c.Files[path] = cachedFile{Size: info.Size(), ModTime: info.ModTime(), Hash: hash}
+	c.dirty = true
+}
+
+// attachment 查找页面上内容相同的附件
+// 参数:
+//   - pageID: 页面ID
+//   - key: 内容哈希
+// 返回:
+//   - cachedAttachment: 附件记录
+//   - bool: 是否命中缓存
+func (c *attachmentCache) attachment(pageID, key string) (cachedAttachment, bool) {
+	attachment, ok := c.Pages[pageID][key]
+	return attachment, ok
+}
+
+// setAttachment 记录页面上的附件，同名附件的旧内容记录随之失效
+func (c *attachmentCache) setAttachment(pageID, key string, attachment cachedAttachment) {
+	page := c.Pages[pageID]
+	if page == nil {
+		page = make(map[string]cachedAttachment)
+		c.Pages[pageID] = page
+	}
+	for k, existing := range page {
+		if existing.Filename == attachment.Filename && k != key {
+			delete(page, k)
+		}
+	}
+	page[key] = attachment
+	c.dirty = true
+}
+
+// removeAttachments 删除页面上指定附件的记录
+func (c *attachmentCache) removeAttachments(pageID string, filenames map[string]bool) {
+	page := c.Pages[pageID]
+	for key, attachment := range page {
+		if filenames[attachment.Filename] {
+			delete(page, key)
+			c.dirty = true
+		}
+	}
+	if page != nil && len(page) == 0 {
+		delete(c.Pages, pageID)
+		c.dirty = true
+	}
+}
+
+// save 将有变化的缓存写回文件
+// 返回:
+//   - error: 写入失败时的错误
+func (c *attachmentCache) save() error {
+	if !c.dirty {
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(c.path), 0755); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	// 先写临时文件再重命名，避免中断时留下不完整的缓存
+	tmp := c.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, c.path); err != nil {
+		return err
+	}
+	c.dirty = false
+	return nil
+}
@@ -1,11 +1,18 @@
 package markdown
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
 	"fmt"
+	"html"
+	"io"
 	"mime"
+	"net/url"
 	"os"
 	"path/filepath"
 	"regexp"
+	"sort"
 	"strconv"
 	"strings"
 
@@ -15,14 +22,24 @@ import (
 
 // ImageHandler 处理图片的上传和处理
 type ImageHandler struct {
-	client      *confluence.Client // Confluence客户端
-	config      *config.Config     // 应用配置
-	pageID      string             // 当前页面ID
-	markdownDir string             // Markdown文件所在目录
-	uploaded    map[string]string  // 已上传图片的缓存，键为本地路径，值为Confluence URL
-	maxWidth    int                // 图片最大宽度
-	maxHeight   int                // 图片最大高度
-	minScale    float64            // 最小缩放比例
+	client            *confluence.Client                // Confluence客户端
+	config            *config.Config                    // 应用配置
+	pageID            string                            // 当前页面ID
+	markdownDir       string                            // Markdown文件所在目录
+	uploaded          map[string]string                 // 已上传图片的缓存，键为本地路径，值为附件文件名
+	claimed           map[string]string                 // 本次处理已分配的附件名，键为附件名，值为来源路径
+	attachments       map[string]*confluence.Attachment // 页面现有附件，键为文件名
+	attachmentsPage   string                            // attachments 所属的页面ID
+	maxWidth          int                               // 图片最大宽度
+	maxHeight         int                               // 图片最大高度
+	minScale          float64                           // 最小缩放比例
+	images            config.ImagesConfig               // 图片尺寸与压缩配置
+	attachmentsConfig config.AttachmentsConfig          // 链接到的本地文件的附件配置
+	cache             *attachmentCache                  // 持久化的附件缓存，关闭时为nil
+	obsidian          config.ObsidianConfig             // Obsidian兼容模式配置
+	vault             *obsidianVault                    // Obsidian仓库索引，首次按文件名查找时建立
+	dryRun            bool                              // 离线模式：本地图片以附件文件名引用，不上传
+	out               io.Writer                         // 进度与警告信息的输出
 }
 
 // NewImageHandler 创建一个新的图片处理器
@@ -32,14 +49,44 @@ type ImageHandler struct {
 // 返回:
 //   - *ImageHandler: 图片处理器实例
 func NewImageHandler(client *confluence.Client, config *config.Config) *ImageHandler {
-	return &ImageHandler{
+	images := imagesConfig(config)
+	h := &ImageHandler{
 		client:    client,
 		config:    config,
 		uploaded:  make(map[string]string),
-		maxWidth:  600, // 默认最大宽度
-		maxHeight: 400, // 默认最大高度
-		minScale:  0.6, // 默认最小缩放比例
+		maxWidth:  images.MaxWidth,  // 默认最大宽度600
+		maxHeight: images.MaxHeight, // 默认最大高度400
+		minScale:  images.MinScale,  // 默认最小缩放比例0.6
+		images:    images,
+		out:       os.Stdout,
 	}
+	if config != nil {
+		h.attachmentsConfig = config.Markdown.Attachments
+		h.obsidian = config.Markdown.Obsidian
+	}
+	return h
+}
+
+// imagesConfig 返回填充默认值后的图片配置
+func imagesConfig(cfg *config.Config) config.ImagesConfig {
+	if cfg == nil {
+		return config.ImagesConfig{}.Resolved()
+	}
+	return cfg.Markdown.Images.Resolved()
+}
+
+// SetDryRun 设置离线模式，用于不连接Confluence的渲染
+// 参数:
+//   - dryRun: 为true时本地图片不上传，直接以附件文件名引用
+func (h *ImageHandler) SetDryRun(dryRun bool) {
+	h.dryRun = dryRun
+}
+
+// SetOutput 设置进度与警告信息的输出位置（默认为标准输出）
+// 参数:
+//   - w: 输出目标
+func (h *ImageHandler) SetOutput(w io.Writer) {
+	h.out = w
 }
 
 // ProcessImages 处理HTML内容中的图片并上传到Confluence
@@ -54,37 +101,68 @@ func (h *ImageHandler) ProcessImages(content, markdownDir, pageID string) (strin
 	// 设置上下文信息
 	h.markdownDir = markdownDir
 	h.pageID = pageID
+	// 附件属于具体页面，名称按页面重新分配
+	h.uploaded = make(map[string]string)
+	h.claimed = make(map[string]string)
+	h.vault = nil // 仓库中的文件可能已变化，每次处理重新建立索引
+	if h.dryRun {
+		h.attachments = nil
+		h.attachmentsPage = ""
+	}
 
-	// 1. 处理HTML中的<img>标签
+	// 代码块与行内代码中的图片语法保持不变
 	imgRe := regexp.MustCompile(`<img[^>]*src="([^"]+)"[^>]*\/?>`)
-	content = imgRe.ReplaceAllStringFunc(content, func(match string) string {
-		// 提取src属性
-		srcMatches := regexp.MustCompile(`src="([^"]+)"`).FindStringSubmatch(match)
-		if len(srcMatches) < 2 {
-			return match
-		}
-		
-		imgSrc := srcMatches[1]
-		// 获取alt文本，如果有的话
-		altText := ""
-		altMatches := regexp.MustCompile(`alt="([^"]*)"`).FindStringSubmatch(match)
-		if len(altMatches) >= 2 {
-			altText = altMatches[1]
-		}
-		
-		// 处理图片引用
-		return h.processImageReference(imgSrc, altText)
+	content = replaceOutsideCode(content, func(part string) string {
+		// 1. 处理HTML中的<img>标签
+		part = imgRe.ReplaceAllStringFunc(part, func(match string) string {
+			// 提取src属性
+			srcMatches := regexp.MustCompile(`src="([^"]+)"`).FindStringSubmatch(match)
+			if len(srcMatches) < 2 {
+				return match
+			}
+
+			// 属性值已转义，生成引用时会重新转义；本地路径还需还原百分号编码（如 %20、尺寸说明前的 %7C）
+			imgSrc := html.UnescapeString(srcMatches[1])
+			if !strings.HasPrefix(imgSrc, "http://") && !strings.HasPrefix(imgSrc, "https://") && !strings.HasPrefix(imgSrc, "data:") {
+				if unescaped, err := url.PathUnescape(imgSrc); err == nil {
+					imgSrc = unescaped
+				}
+			}
+			// 获取alt、title、尺寸与对齐方式
+			return h.processImageReference(imgSrc, parseImageOptions(match))
+		})
+
+		// 2. 处理Markdown格式的图片引用 ![alt](path)
+		part = regexp.MustCompile(`!\[(.*?)\]\((.*?)\)`).ReplaceAllStringFunc(part, h.replaceImage)
+
+		// 3. 处理Obsidian格式的图片引用 ![[path]]
+		return regexp.MustCompile(`!\[\[(.*?)\]\]`).ReplaceAllStringFunc(part, h.replaceObsidianImage)
 	})
-	
-	// 2. 处理Markdown格式的图片引用 ![alt](path)
-	content = regexp.MustCompile(`!\[(.*?)\]\((.*?)\)`).ReplaceAllStringFunc(content, h.replaceImage)
-	
-	// 3. 处理Obsidian格式的图片引用 ![[path]]
-	content = regexp.MustCompile(`!\[\[(.*?)\]\]`).ReplaceAllStringFunc(content, h.replaceObsidianImage)
+
+	// 4. 链接到的本地文件上传为附件
+	content = h.processFileLinks(content)
+
+	// 保存附件缓存，失败不影响发布
+	if h.cache != nil {
+		if err := h.cache.save(); err != nil {
+			fmt.Fprintf(h.out, "⚠️ 警告: 保存附件缓存失败: %v\n", err)
+		}
+	}
 
 	return content, nil
 }
 
+// attachmentCache 返回附件缓存，首次使用时从文件加载；离线模式或关闭缓存时返回nil
+func (h *ImageHandler) attachmentCache() *attachmentCache {
+	if h.dryRun || h.images.Cache == config.ImagesCacheOff {
+		return nil
+	}
+	if h.cache == nil {
+		h.cache = loadAttachmentCache(h.images.Cache, h.out)
+	}
+	return h.cache
+}
+
 // replaceImage 处理标准Markdown格式的图片引用
 // 参数:
 //   - match: 匹配到的Markdown图片字符串，格式为![alt](path)
@@ -100,7 +178,7 @@ func (h *ImageHandler) replaceImage(match string) string {
 	altText := submatches[1]   // 图片替代文本
 	imagePath := submatches[2] // 图片路径
 
-	return h.processImageReference(imagePath, altText)
+	return h.processImageReference(imagePath, imageOptions{alt: altText})
 }
 
 // replaceObsidianImage 处理Obsidian格式的图片引用
@@ -116,57 +194,167 @@ func (h *ImageHandler) replaceObsidianImage(match string) string {
 	}
 
 	imagePath := submatches[1] // 图片路径
-	return h.processImageReference(imagePath, "") // Obsidian格式没有alt文本
+	return h.processImageReference(imagePath, imageOptions{}) // Obsidian格式没有alt文本
 }
 
 // processImageReference 处理图片引用并生成Confluence XML
 // 参数:
 //   - imagePath: 图片路径（可能是相对路径或URL）
-//   - altText: 图片替代文本
+//   - options: 替代文本、标题、对齐方式与指定的尺寸
 // 返回:
 //   - string: Confluence XML格式的图片标签
-func (h *ImageHandler) processImageReference(imagePath, altText string) string {
-	// 处理图片路径并获取尺寸信息
-	fullPath, size := h.processImagePath(imagePath)
+func (h *ImageHandler) processImageReference(imagePath string, options imageOptions) string {
+	// 处理图片路径并获取尺寸信息，width/height 属性优先于路径中的尺寸说明
+	fullPath, size, explicit := h.processImagePath(imagePath)
+	if !options.explicit {
+		options.size, options.explicit = size, explicit
+	}
 	
-	// 处理远程URL
+	// data URI图片（如粘贴的截图）解码后上传为附件
+	if strings.HasPrefix(fullPath, "data:") {
+		return h.processEmbeddedImage(fullPath, options)
+	}
+	
+	// 处理远程URL：开启 rehost 时下载并上传为附件，否则（或下载失败时）以URL引用
 	if strings.HasPrefix(fullPath, "http://") || strings.HasPrefix(fullPath, "https://") {
-		// 转义URL中的XML特殊字符
-		escapedURL := escapeXMLAttributeValue(fullPath)
-		
-		// 根据是否有尺寸生成适当的XML
-		if size > 0 {
-			return fmt.Sprintf("<ac:image ac:width=\"%d\"><ri:url ri:value=\"%s\"/></ac:image>", 
-				size, escapedURL)
+		if h.images.Rehost && !h.dryRun {
+			if result := h.processRemoteImage(fullPath, options); result != "" {
+				return result
+			}
 		}
-		return fmt.Sprintf("<ac:image><ri:url ri:value=\"%s\"/></ac:image>", escapedURL)
+		return imageMacro(options, fmt.Sprintf("<ri:url ri:value=\"%s\"/>", escapeXMLAttributeValue(fullPath)))
 	}
 	
 	// 处理本地文件
 	if _, err := os.Stat(fullPath); err == nil {
+		// 未指定尺寸时按配置的范围缩放显示
+		if !options.explicit {
+			options.size = h.displaySize(fullPath)
+		}
+
+		// 离线模式下以附件文件名引用
+		if h.dryRun {
+			return imageMacro(options, h.attachmentReference(h.attachmentName(filepath.Base(fullPath), h.attachmentSource(fullPath))))
+		}
+
 		// 上传图片到Confluence
-		imageURL, err := h.uploadImage(fullPath)
+		filename, err := h.uploadImage(fullPath)
 		if err != nil {
-			fmt.Printf("⚠️ 警告: 图片上传失败 %s: %v\n", fullPath, err)
+			fmt.Fprintf(h.out, "⚠️ 警告: 图片上传失败 %s: %v\n", fullPath, err)
 			return ""
 		}
 		
-		// 转义URL中的XML特殊字符
-		escapedURL := escapeXMLAttributeValue(imageURL)
-		
-		// 根据是否有尺寸生成适当的XML
-		if size > 0 {
-			return fmt.Sprintf("<ac:image ac:width=\"%d\"><ri:url ri:value=\"%s\"/></ac:image>", 
-				size, escapedURL)
-		}
-		return fmt.Sprintf("<ac:image><ri:url ri:value=\"%s\"/></ac:image>", escapedURL)
+		// 以附件引用，页面移动、复制或站点地址变化后仍然有效
+		return imageMacro(options, h.attachmentReference(filename))
 	}
 	
 	// 图片文件未找到
-	fmt.Printf("⚠️ 警告: 图片文件未找到: %s\n", fullPath)
+	fmt.Fprintf(h.out, "⚠️ 警告: 图片文件未找到: %s\n", fullPath)
 	return ""
 }
 
+// attachmentReference 生成附件引用
+// 参数:
+//   - filename: 附件文件名
+// 返回:
+//   - string: ri:attachment 元素
+func (h *ImageHandler) attachmentReference(filename string) string {
+	return fmt.Sprintf("<ri:attachment ri:filename=\"%s\"/>", escapeXMLAttributeValue(filename))
+}
+
+// displaySize 读取本地图片尺寸，计算适合 maxWidth/maxHeight 的显示尺寸
+// 参数:
+//   - path: 图片路径
+// 返回:
+//   - imageSize: 显示尺寸，无需缩放或无法识别格式时为空
+func (h *ImageHandler) displaySize(path string) imageSize {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return imageSize{}
+	}
+	width, height, err := readImageSize(data)
+	if err != nil {
+		return imageSize{}
+	}
+	return fitImageSize(width, height, h.maxWidth, h.maxHeight, h.minScale)
+}
+
+// imageOptions 图片的显示选项
+type imageOptions struct {
+	size     imageSize // 显示尺寸，为0的一边不指定
+	explicit bool      // 是否指定了尺寸，未指定时按配置的范围自动缩放
+	align    string    // 对齐方式：left、center、right
+	alt      string    // 替代文本
+	title    string    // 标题（鼠标悬停时显示）
+}
+
+// imageAlignments HTML align 属性对应的对齐方式
+var imageAlignments = map[string]string{"left": "left", "center": "center", "middle": "center", "right": "right"}
+
+// imageAttributePattern <img> 标签的属性
+var imageAttributePattern = regexp.MustCompile(`(?i)\s(alt|title|width|height|align)\s*=\s*(?:"([^"]*)"|'([^']*)')`)
+
+// parseImageOptions 从 <img> 标签的 alt、title、width、height 和 align 属性读取显示选项
+// 参数:
+//   - tag: <img> 标签
+// 返回:
+//   - imageOptions: 显示选项，width 或 height 有效时视为指定了尺寸
+func parseImageOptions(tag string) imageOptions {
+	var options imageOptions
+	for _, match := range imageAttributePattern.FindAllStringSubmatch(tag, -1) {
+		value := html.UnescapeString(match[2] + match[3])
+		switch strings.ToLower(match[1]) {
+		case "alt":
+			options.alt = value
+		case "title":
+			options.title = value
+		case "width":
+			options.size.width = parsePixels(value)
+		case "height":
+			options.size.height = parsePixels(value)
+		case "align":
+			options.align = imageAlignments[strings.ToLower(strings.TrimSpace(value))]
+		}
+	}
+	options.explicit = options.size.width > 0 || options.size.height > 0
+	return options
+}
+
+// parsePixels 解析像素值（如 300 或 300px），百分比等其他单位返回0
+func parsePixels(value string) int {
+	pixels, err := strconv.Atoi(strings.TrimSuffix(strings.TrimSpace(value), "px"))
+	if err != nil || pixels <= 0 {
+		return 0
+	}
+	return pixels
+}
+
+// imageMacro 生成 ac:image 元素
+// 参数:
+//   - options: 显示选项，尺寸为0的一边不指定
+//   - resource: 图片资源（ri:attachment 或 ri:url）
+// 返回:
+//   - string: Confluence XML格式的图片标签
+func imageMacro(options imageOptions, resource string) string {
+	attrs := ""
+	if options.align != "" {
+		attrs += fmt.Sprintf(" ac:align=\"%s\"", options.align)
+	}
+	if options.size.width > 0 {
+		attrs += fmt.Sprintf(" ac:width=\"%d\"", options.size.width)
+	}
+	if options.size.height > 0 {
+		attrs += fmt.Sprintf(" ac:height=\"%d\"", options.size.height)
+	}
+	if options.alt != "" {
+		attrs += fmt.Sprintf(" ac:alt=\"%s\"", escapeXMLAttributeValue(options.alt))
+	}
+	if options.title != "" {
+		attrs += fmt.Sprintf(" ac:title=\"%s\"", escapeXMLAttributeValue(options.title))
+	}
+	return fmt.Sprintf("<ac:image%s>%s</ac:image>", attrs, resource)
+}
+
 // escapeXMLAttributeValue 转义XML属性值中的特殊字符
 // 参数:
 //   - s: 需要转义的字符串
@@ -184,26 +372,23 @@ func escapeXMLAttributeValue(s string) string {
 
 // processImagePath 处理图片路径并提取尺寸信息
 // 参数:
-//   - imagePath: 图片路径（可能包含尺寸信息）
+//   - imagePath: 图片路径（可能包含尺寸信息，如 img.png|400 或 img.png|400x300）
 // 返回:
 //   - string: 处理后的完整图片路径
-//   - int: 图片尺寸（如果指定了的话）
-func (h *ImageHandler) processImagePath(imagePath string) (string, int) {
+//   - imageSize: 图片尺寸（如果指定了的话）
+//   - bool: 是否指定了尺寸
+func (h *ImageHandler) processImagePath(imagePath string) (string, imageSize, bool) {
 	// 提取尺寸信息（如果存在）
-	size := 0
-	if strings.Contains(imagePath, "|") {
-		parts := strings.Split(imagePath, "|")
-		imagePath = parts[0]
-		if len(parts) > 1 {
-			if s, err := strconv.Atoi(parts[1]); err == nil {
-				size = s
-			}
-		}
+	var size imageSize
+	explicit := false
+	if idx := strings.LastIndex(imagePath, "|"); idx >= 0 {
+		size, explicit = parseImageSize(imagePath[idx+1:])
+		imagePath = imagePath[:idx]
 	}
 	
-	// 直接处理远程URL
-	if strings.HasPrefix(imagePath, "http://") || strings.HasPrefix(imagePath, "https://") {
-		return imagePath, size
+	// 直接处理远程URL与data URI
+	if strings.HasPrefix(imagePath, "http://") || strings.HasPrefix(imagePath, "https://") || strings.HasPrefix(imagePath, "data:") {
+		return imagePath, size, explicit
 	}
 	
 	// 标准化路径分隔符
@@ -211,7 +396,7 @@ func (h *ImageHandler) processImagePath(imagePath string) (string, int) {
 	
 	// 如果是绝对路径，直接使用
 	if filepath.IsAbs(imagePath) {
-		return imagePath, size
+		return imagePath, size, explicit
 	}
 	
 	// 尝试多种可能的相对路径
@@ -239,19 +424,41 @@ func (h *ImageHandler) processImagePath(imagePath string) (string, int) {
 	// 检查每个可能的路径
 	for _, path := range possiblePaths {
 		if _, err := os.Stat(path); err == nil {
-			return path, size // 返回第一个存在的路径
+			return path, size, explicit // 返回第一个存在的路径
 		}
 	}
 	
+	// 5. Obsidian兼容模式下在整个仓库中按文件名查找
+	if path, ok := h.findInVault(imagePath); ok {
+		return path, size, explicit
+	}
+	
 	// 打印调试信息，提示所有尝试过的路径
-	fmt.Printf("⚠️ 警告: 图片文件未找到: %s\n", imagePath)
-	fmt.Println("尝试过的路径:")
+	fmt.Fprintf(h.out, "⚠️ 警告: 图片文件未找到: %s\n", imagePath)
+	fmt.Fprintln(h.out, "尝试过的路径:")
 	for _, path := range possiblePaths {
-		fmt.Printf("- %s\n", path)
+		fmt.Fprintf(h.out, "- %s\n", path)
 	}
 	
 	// 返回默认路径（后续会处理失败）
-	return filepath.Join(h.markdownDir, imagePath), size
+	return filepath.Join(h.markdownDir, imagePath), size, explicit
+}
+
+// findInVault 在Obsidian仓库中按文件名查找文件，未启用兼容模式时不查找
+// 参数:
+//   - name: 引用的文件名（可带部分路径）
+// 返回:
+//   - string: 文件路径
+//   - bool: 是否找到
+func (h *ImageHandler) findInVault(name string) (string, bool) {
+	if !h.obsidian.Enabled {
+		return "", false
+	}
+	root := findVaultRoot(h.obsidian.Vault, h.markdownDir)
+	if h.vault == nil || h.vault.root != root {
+		h.vault = loadObsidianVault(root)
+	}
+	return h.vault.resolve(name)
 }
 
 // getContentType 确定文件的MIME类型
@@ -272,133 +479,360 @@ func (h *ImageHandler) getContentType(path string) string {
 // 参数:
 //   - imagePath: 图片文件的本地路径
 // 返回:
-//   - string: 上传后的图片URL
+//   - string: 附件文件名
 //   - error: 上传过程中的错误
 func (h *ImageHandler) uploadImage(imagePath string) (string, error) {
-	// 检查缓存中是否已有此图片
-	if url, exists := h.uploaded[imagePath]; exists {
-		return url, nil
-	}
+	return h.uploadLocalFile(imagePath, h.getContentType(imagePath))
+}
 
+// uploadLocalFile 上传本地文件为当前页面的附件
+// 文件未修改且已上传到当前页面时（根据附件缓存判断，并与页面附件列表核对），不再读取或上传文件
+// 参数:
+//   - path: 本地文件路径
+//   - contentType: 内容类型
+// 返回:
+//   - string: 附件文件名
+//   - error: 上传过程中的错误
+func (h *ImageHandler) uploadLocalFile(path, contentType string) (string, error) {
 	// 确保使用绝对路径
-	var absImagePath string
-	if filepath.IsAbs(imagePath) {
-		absImagePath = imagePath
-	} else {
-		var err error
-		absImagePath, err = filepath.Abs(imagePath)
-		if err != nil {
-			return "", fmt.Errorf("获取绝对路径失败: %w", err)
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return "", fmt.Errorf("获取绝对路径失败: %w", err)
+	}
+
+	// 确认文件存在
+	info, err := os.Stat(absPath)
+	if err != nil {
+		fmt.Fprintf(h.out, "⚠️ 警告: 文件未找到 %s\n", absPath)
+		return "", fmt.Errorf("文件未找到: %w", err)
+	}
+
+	// 检查缓存中是否已有此文件
+	source := h.attachmentSource(absPath)
+	if filename, exists := h.uploaded[source]; exists {
+		return filename, nil
+	}
+	cache := h.attachmentCache()
+	if cache != nil {
+		if hash, ok := cache.fileHash(absPath, info); ok {
+			if filename, ok := h.cachedAttachment(hash, source); ok {
+				return filename, nil
+			}
 		}
 	}
 
-	// 确认图片文件存在
-	if _, err := os.Stat(absImagePath); err != nil {
-		fmt.Printf("⚠️ 警告: 图片未找到 %s\n", absImagePath)
-		return "", fmt.Errorf("图片文件未找到: %w", err)
+	// 读取文件内容
+	fileContent, err := os.ReadFile(absPath)
+	if err != nil {
+		return "", fmt.Errorf("读取文件失败: %w", err)
+	}
+	if cache != nil {
+		cache.setFileHash(absPath, info, contentHash(fileContent))
+	}
+
+	return h.uploadContent(filepath.Base(absPath), source, fileContent, contentType)
+}
+
+// cachedAttachment 在附件缓存中查找当前页面上内容相同的附件
+// 缓存记录的附件ID与版本需与页面附件列表一致，附件在页面上被删除或修改后重新上传
+// 参数:
+//   - hash: 原始内容的哈希
+//   - source: 图片来源
+// 返回:
+//   - string: 附件文件名
+//   - bool: 是否命中缓存
+func (h *ImageHandler) cachedAttachment(hash, source string) (string, bool) {
+	cache := h.attachmentCache()
+	if cache == nil {
+		return "", false
+	}
+	attachment, ok := cache.attachment(h.pageID, h.cacheKey(hash))
+	if !ok {
+		return "", false
+	}
+	// 附件名已被本次处理中内容不同的文件占用时不使用缓存
+	if claimedBy, exists := h.claimed[attachment.Filename]; exists && claimedBy != source && claimedBy != attachment.Source {
+		return "", false
+	}
+	if err := h.loadAttachments(); err != nil {
+		fmt.Fprintf(h.out, "⚠️ 警告: 获取附件列表失败: %v\n", err)
+		return "", false
+	}
+	if current := h.attachments[attachment.Filename]; current == nil || current.ID != attachment.ID || current.Version.Number != attachment.Version {
+		fmt.Fprintf(h.out, "ℹ️ 提示: 附件 %s 与缓存记录不一致，重新检查\n", attachment.Filename)
+		return "", false
+	}
+	if _, exists := h.claimed[attachment.Filename]; !exists {
+		h.claimed[attachment.Filename] = source
+	}
+	h.uploaded[source] = attachment.Filename
+	fmt.Fprintf(h.out, "ℹ️ 提示: 附件 %s 未变化（缓存），跳过上传\n", attachment.Filename)
+	return attachment.Filename, true
+}
+
+// cacheKey 返回附件缓存的键，开启缩小时包含缩小参数
+func (h *ImageHandler) cacheKey(hash string) string {
+	if h.images.Resize {
+		return fmt.Sprintf("%s@%dx%dq%d", hash, h.images.ResizeWidth, h.images.ResizeHeight, h.images.Quality)
+	}
+	return hash
+}
+
+// uploadContent 将图片内容上传为当前页面的附件
+// 参数:
+//   - basename: 期望的附件文件名
+//   - source: 图片来源（本地相对路径、URL或data URI的哈希），记录在附件备注中
+//   - fileContent: 图片内容
+//   - contentType: 内容类型
+// 返回:
+//   - string: 附件文件名
+//   - error: 上传过程中的错误
+func (h *ImageHandler) uploadContent(basename, source string, fileContent []byte, contentType string) (string, error) {
+	if filename, exists := h.uploaded[source]; exists {
+		return filename, nil
 	}
+	originalHash := contentHash(fileContent)
+	if filename, ok := h.cachedAttachment(originalHash, source); ok {
+		return filename, nil
+	}
+	filename := h.attachmentName(basename, source)
+	var recorded *confluence.Attachment
+	defer func() {
+		// 记录成功上传或确认未变化的附件
+		if cache := h.attachmentCache(); cache != nil && h.uploaded[source] == filename && recorded != nil {
+			cache.setAttachment(h.pageID, h.cacheKey(originalHash), cachedAttachment{
+				Filename: filename,
+				Source:   source,
+				ID:       recorded.ID,
+				Version:  recorded.Version.Number,
+			})
+		}
+	}()
 
-	// 获取文件名和内容类型
-	filename := filepath.Base(absImagePath)
-	contentType := h.getContentType(absImagePath)
+	// 按配置缩小并重新压缩过大的图片
+	if h.images.Resize && strings.HasPrefix(contentType, "image/") {
+		shrunk, resized, err := shrinkImage(fileContent, h.images.ResizeWidth, h.images.ResizeHeight, h.images.Quality)
+		if err != nil {
+			fmt.Fprintf(h.out, "⚠️ 警告: 无法缩小图片 %s，上传原图: %v\n", filename, err)
+		} else if resized {
+			fmt.Fprintf(h.out, "ℹ️ 提示: 图片 %s 已缩小 (%d KB -> %d KB)\n", filename, len(fileContent)/1024, len(shrunk)/1024)
+			fileContent = shrunk
+		}
+	}
 
-	// 读取图片文件内容
-	fileContent, err := os.ReadFile(absImagePath)
+	// 比较内容哈希：同名附件未变化时直接引用，变化时上传新版本
+	hash := contentHash(fileContent)
+	comment := attachmentComment(hash, source)
+	attachment, err := h.existingAttachment(filename)
 	if err != nil {
-		return "", fmt.Errorf("读取图片文件失败: %w", err)
+		fmt.Fprintf(h.out, "⚠️ 警告: 获取附件列表失败: %v\n", err)
+	}
+	if attachment != nil {
+		if attachmentHash(attachment.Metadata.Comment) == hash {
+			fmt.Fprintf(h.out, "ℹ️ 提示: 图片 %s 未变化，使用现有附件\n", filename)
+			h.uploaded[source] = filename
+			recorded = attachment
+			return filename, nil
+		}
+		
+		response, err := h.client.UpdateAttachmentData(h.pageID, attachment.ID, filename, fileContent, comment)
+		if err != nil {
+			fmt.Fprintf(h.out, "⚠️ 警告: 更新图片失败: %v\n", err)
+			return "", fmt.Errorf("更新Confluence附件失败: %w", err)
+		}
+		attachment.Metadata.Comment = comment
+		if updated := uploadedAttachment(response); updated != nil {
+			attachment.Version = updated.Version
+			recorded = attachment
+		}
+		h.uploaded[source] = filename
+		fmt.Fprintf(h.out, "✓ 图片已更新: %s\n", filename)
+		return filename, nil
 	}
 
 	// 上传到Confluence
-	result, err := h.client.AttachFile(h.pageID, filename, fileContent, contentType)
+	response, err := h.client.AttachFile(h.pageID, filename, fileContent, contentType, comment)
 	if err != nil {
-		// 处理重复文件名错误
+		// 处理重复文件名错误：无法获取附件列表时，直接引用同名附件
 		if strings.Contains(err.Error(), "Cannot add a new attachment with same file name") {
-			fmt.Printf("ℹ️ 提示: 图片 %s 已存在，正在获取现有图片的URL\n", filename)
-			
-			// 获取当前页面的所有附件
-			attachments, attachErr := h.client.GetAttachments(h.pageID)
-			if attachErr != nil {
-				return "", fmt.Errorf("获取附件列表失败: %w", attachErr)
-			}
-			
-			// 查找匹配文件名的附件
-			for _, attachment := range attachments {
-				if title, ok := attachment["title"].(string); ok && title == filename {
-					// 提取下载URL
-					if links, ok := attachment["_links"].(map[string]interface{}); ok {
-						if download, ok := links["download"].(string); ok {
-							// 确保URL是绝对路径
-							imageURL := download
-							if !strings.HasPrefix(imageURL, "http://") && !strings.HasPrefix(imageURL, "https://") {
-								baseURL := strings.TrimSuffix(h.config.Confluence.URL, "/")
-								imageURL = fmt.Sprintf("%s%s", baseURL, imageURL)
-							}
-							
-							// 缓存URL
-							h.uploaded[imagePath] = imageURL
-							fmt.Printf("✓ 使用现有图片: %s\n", filename)
-							fmt.Printf("  图片URL: %s\n", imageURL)
-							return imageURL, nil
-						}
-					}
-				}
-			}
-			
-			// 找不到匹配的附件
-			return "", fmt.Errorf("未找到现有附件: %s", filename)
+			fmt.Fprintf(h.out, "ℹ️ 提示: 图片 %s 已存在，使用现有附件\n", filename)
+			h.uploaded[source] = filename
+			return filename, nil
 		}
 		
 		// 其他上传错误
-		fmt.Printf("⚠️ 警告: 上传图片失败: %v\n", err)
+		fmt.Fprintf(h.out, "⚠️ 警告: 上传图片失败: %v\n", err)
 		return "", fmt.Errorf("上传到Confluence失败: %w", err)
 	}
 
-	// 从响应中提取URL
-	var imageURL string
-	
-	// 方法1: 检查_links.download字段
-	if links, ok := result["_links"].(map[string]interface{}); ok {
-		if download, ok := links["download"].(string); ok {
-			imageURL = download
+	// 缓存并返回附件文件名
+	if created := uploadedAttachment(response); created != nil {
+		if h.attachments != nil && h.attachmentsPage == h.pageID {
+			h.attachments[filename] = created
 		}
+		recorded = created
 	}
-	
-	// 方法2: 检查results数组中的第一个结果
-	if imageURL == "" && result["results"] != nil {
-		if results, ok := result["results"].([]interface{}); ok && len(results) > 0 {
-			if firstResult, ok := results[0].(map[string]interface{}); ok {
-				if links, ok := firstResult["_links"].(map[string]interface{}); ok {
-					if download, ok := links["download"].(string); ok {
-						imageURL = download
-					}
-				}
+	h.uploaded[source] = filename
+	fmt.Fprintf(h.out, "✓ 图片上传成功: %s\n", filename)
+	return filename, nil
+}
+
+// uploadedAttachment 从上传接口的响应中提取附件信息
+// 新建附件的响应为 {"results":[附件]}，更新附件数据的响应为附件本身
+// 参数:
+//   - response: 上传接口的响应
+// 返回:
+//   - *confluence.Attachment: 附件信息，响应中没有附件ID时为nil
+func uploadedAttachment(response map[string]interface{}) *confluence.Attachment {
+	data, err := json.Marshal(response)
+	if err != nil {
+		return nil
+	}
+	var result struct {
+		confluence.Attachment
+		Results []confluence.Attachment `json:"results"`
+	}
+	if err := json.Unmarshal(data, &result); err != nil {
+		return nil
+	}
+	attachment := &result.Attachment
+	if len(result.Results) > 0 {
+		attachment = &result.Results[0]
+	}
+	if attachment.ID == "" {
+		return nil
+	}
+	return attachment
+}
+
+// attachmentName 为图片分配附件名
+// 优先沿用附件备注中记录了相同来源路径的附件；文件名未被其他来源占用时使用原文件名，
+// 否则在文件名后追加来源路径的哈希，保证不同目录下的同名文件不会互相覆盖，且重复发布时名称不变
+// 参数:
+//   - basename: 期望的附件文件名
+//   - source: 图片来源
+// 返回:
+//   - string: 附件名
+func (h *ImageHandler) attachmentName(basename, source string) string {
+	// 已有附件记录了相同的来源
+	if !h.dryRun {
+		if err := h.loadAttachments(); err != nil {
+			fmt.Fprintf(h.out, "⚠️ 警告: 获取附件列表失败: %v\n", err)
+		}
+		titles := make([]string, 0, len(h.attachments))
+		for title := range h.attachments {
+			titles = append(titles, title)
+		}
+		sort.Strings(titles)
+		for _, title := range titles {
+			if attachmentSourcePath(h.attachments[title].Metadata.Comment) == source && h.claim(title, source) {
+				return title
 			}
 		}
 	}
-	
-	// 方法3: 尝试从ID和文件名构建URL
-	if imageURL == "" && result["id"] != nil {
-		if _, ok := result["id"].(string); ok {
-			baseURL := strings.TrimSuffix(h.config.Confluence.URL, "/")
-			imageURL = fmt.Sprintf("%s/download/attachments/%s/%s", baseURL, h.pageID, filename)
+
+	name := basename
+	if h.claim(name, source) {
+		return name
+	}
+
+	ext := filepath.Ext(name)
+	sum := sha256.Sum256([]byte(source))
+	name = fmt.Sprintf("%s-%s%s", strings.TrimSuffix(name, ext), hex.EncodeToString(sum[:4]), ext)
+	h.claimed[name] = source
+	return name
+}
+
+// claim 尝试为来源路径占用附件名
+// 附件名未被本次处理的其他文件使用，且页面上的同名附件未记录其他来源时占用成功
+func (h *ImageHandler) claim(name, source string) bool {
+	if claimedBy, ok := h.claimed[name]; ok {
+		return claimedBy == source
+	}
+	if attachment := h.attachments[name]; attachment != nil {
+		if recorded := attachmentSourcePath(attachment.Metadata.Comment); recorded != "" && recorded != source {
+			return false
 		}
 	}
-	
-	// 确保URL是绝对路径
-	if imageURL != "" {
-		if !strings.HasPrefix(imageURL, "http://") && !strings.HasPrefix(imageURL, "https://") {
-			baseURL := strings.TrimSuffix(h.config.Confluence.URL, "/")
-			imageURL = fmt.Sprintf("%s%s", baseURL, imageURL)
+	h.claimed[name] = source
+	return true
+}
+
+// attachmentSource 返回记录在附件备注中的来源路径（相对于Markdown文件目录）
+func (h *ImageHandler) attachmentSource(path string) string {
+	if h.markdownDir != "" {
+		if absDir, err := filepath.Abs(h.markdownDir); err == nil {
+			if absPath, err := filepath.Abs(path); err == nil {
+				if rel, err := filepath.Rel(absDir, absPath); err == nil {
+					return filepath.ToSlash(rel)
+				}
+			}
 		}
-		
-		// 缓存并返回URL
-		h.uploaded[imagePath] = imageURL
-		fmt.Printf("✓ 图片上传成功: %s\n", filename)
-		fmt.Printf("  图片URL: %s\n", imageURL)
-		return imageURL, nil
 	}
-	
-	// 找不到URL
-	fmt.Printf("⚠️ 警告: 无法获取图片 %s 的URL，请检查API响应\n", filename)
-	return "", fmt.Errorf("无法获取已上传图片的URL")
-} 
\ No newline at end of file
+	return filepath.ToSlash(path)
+}
+
+// existingAttachment 查找当前页面上的同名附件
+// 参数:
+//   - filename: 附件文件名
+// 返回:
+//   - *confluence.Attachment: 同名附件，不存在时为nil
+//   - error: 获取附件列表失败时的错误
+func (h *ImageHandler) existingAttachment(filename string) (*confluence.Attachment, error) {
+	if err := h.loadAttachments(); err != nil {
+		return nil, err
+	}
+	return h.attachments[filename], nil
+}
+
+// loadAttachments 获取当前页面的附件列表，每个页面只获取一次
+func (h *ImageHandler) loadAttachments() error {
+	if h.attachmentsPage == h.pageID && h.attachments != nil {
+		return nil
+	}
+
+	h.attachments = make(map[string]*confluence.Attachment)
+	h.attachmentsPage = h.pageID
+	attachments, err := h.client.ListAttachments(h.pageID)
+	if err != nil {
+		return err
+	}
+	for i := range attachments {
+		h.attachments[attachments[i].Title] = &attachments[i]
+	}
+	return nil
+}
+
+var (
+	// attachmentHashPattern 附件备注中记录的内容哈希
+	attachmentHashPattern = regexp.MustCompile(`sha256:([0-9a-f]{64})`)
+	// attachmentSourcePattern 附件备注中记录的来源路径
+	attachmentSourcePattern = regexp.MustCompile(`, source:(.*)\)$`)
+)
+
+// contentHash 计算文件内容的SHA-256哈希
+func contentHash(content []byte) string {
+	sum := sha256.Sum256(content)
+	return hex.EncodeToString(sum[:])
+}
+
+// attachmentComment 生成记录内容哈希与来源路径的附件备注
+func attachmentComment(hash, source string) string {
+	return fmt.Sprintf("%s (sha256:%s, source:%s)", confluence.DefaultAttachmentComment, hash, source)
+}
+
+// attachmentHash 从附件备注中提取内容哈希，没有记录时返回空
+func attachmentHash(comment string) string {
+	if m := attachmentHashPattern.FindStringSubmatch(comment); m != nil {
+		return m[1]
+	}
+	return ""
+}
+
+// attachmentSourcePath 从附件备注中提取来源路径，没有记录时返回空
+func attachmentSourcePath(comment string) string {
+	if m := attachmentSourcePattern.FindStringSubmatch(comment); m != nil {
+		return m[1]
+	}
+	return ""
+}
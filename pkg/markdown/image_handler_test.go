@@ -0,0 +1,424 @@
+package markdown
+
+import (
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"regexp"
+	"testing"
+
+	"github.com/HelloAnner/markdown-sync-confluence/pkg/config"
+	"github.com/HelloAnner/markdown-sync-confluence/pkg/confluence"
+	"github.com/stretchr/testify/assert"
+)
+
+// newTestImageHandler 创建连接到模拟Confluence服务的图片处理器
+func newTestImageHandler(t *testing.T, handler http.HandlerFunc) *ImageHandler {
+	return newCachedTestImageHandler(t, handler, filepath.Join(t.TempDir(), "attachments.json"))
+}
+
+// newCachedTestImageHandler 创建使用指定附件缓存文件的图片处理器
+func newCachedTestImageHandler(t *testing.T, handler http.HandlerFunc, cachePath string) *ImageHandler {
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+
+	cfg := &config.Config{Confluence: config.ConfluenceConfig{URL: server.URL}}
+	cfg.Markdown.Images.Cache = cachePath
+	return NewImageHandler(confluence.NewClient(cfg), cfg)
+}
+
+func TestImageAttachmentReference(t *testing.T) {
+	dir := t.TempDir()
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "a.png"), []byte("png"), 0644))
+
+	var uploads []string
+	h := newTestImageHandler(t, func(w http.ResponseWriter, r *http.Request) {
+		uploads = append(uploads, r.Method+" "+r.URL.Path)
+		if r.Method == http.MethodGet {
+			w.Write([]byte(`{"results":[]}`))
+			return
+		}
+		w.Write([]byte(`{"results":[{"id":"att1","title":"a.png"}]}`))
+	})
+
+	content, err := h.ProcessImages(`<p><img src="a.png" alt="A"/> <img src="https://example.com/b.png?x=1&amp;y=2" alt="B"/></p>`, dir, "42")
+	assert.NoError(t, err)
+	assert.Equal(t, `<p><ac:image ac:alt="A"><ri:attachment ri:filename="a.png"/></ac:image> <ac:image ac:alt="B"><ri:url ri:value="https://example.com/b.png?x=1&amp;y=2"/></ac:image></p>`, content)
+	assert.Equal(t, []string{"GET /rest/api/content/42/child/attachment", "POST /rest/api/content/42/child/attachment"}, uploads)
+
+	content, err = h.ProcessImages(`![A](a.png|300)`, dir, "7")
+	assert.NoError(t, err)
+	assert.Equal(t, `<ac:image ac:width="300" ac:alt="A"><ri:attachment ri:filename="a.png"/></ac:image>`, content)
+
+	// 代码块中的图片语法保持不变
+	code := `<ac:plain-text-body><![CDATA[<img src="a.png"/> ![A](a.png) ![[a.png]]]]></ac:plain-text-body>`
+	content, err = h.ProcessImages(code, dir, "7")
+	assert.NoError(t, err)
+	assert.Equal(t, code, content)
+
+	// 行内代码中的图片语法同样保持不变，不下载也不上传
+	inline := `<p>Inline <code>![a](x.png)</code>, <code>![[x.png]]</code> and <code>![r](https://example.com/r.png)</code> here</p>`
+	requests := len(uploads)
+	content, err = h.ProcessImages(inline, dir, "7")
+	assert.NoError(t, err)
+	assert.Equal(t, inline, content)
+	assert.Len(t, uploads, requests)
+}
+
+func TestImageOptions(t *testing.T) {
+	dir := t.TempDir()
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "a.png"), encodePNG(t, 900, 600), 0644))
+
+	h := newTestImageHandler(t, nil)
+	h.SetDryRun(true)
+
+	for input, expected := range map[string]string{
+		`<img src="a.png" alt="A &amp; B" title="Tip"/>`:                          `<ac:image ac:width="600" ac:height="400" ac:alt="A &amp; B" ac:title="Tip"><ri:attachment ri:filename="a.png"/></ac:image>`,
+		`<img src="a.png" width="300px" align="middle"/>`:                         `<ac:image ac:align="center" ac:width="300"><ri:attachment ri:filename="a.png"/></ac:image>`,
+		`<img src="a.png%7C200x100" height="50" align="bogus"/>`:                  `<ac:image ac:height="50"><ri:attachment ri:filename="a.png"/></ac:image>`,
+		`<img src="a.png%7C200x100" width="50%"/>`:                                `<ac:image ac:width="200" ac:height="100"><ri:attachment ri:filename="a.png"/></ac:image>`,
+		`<img src="https://example.com/x.png" alt="X" align="left" height="80"/>`: `<ac:image ac:align="left" ac:height="80" ac:alt="X"><ri:url ri:value="https://example.com/x.png"/></ac:image>`,
+	} {
+		content, err := h.ProcessImages(input, dir, "")
+		assert.NoError(t, err)
+		assert.Equal(t, expected, content, input)
+		assert.NoError(t, ValidateStorage(content, ""))
+	}
+}
+
+func TestObsidianVaultImages(t *testing.T) {
+	vault := t.TempDir()
+	for _, name := range []string{".obsidian/app.json", "notes/doc.md", "assets/deep/pic.png", "assets/other/pic.png"} {
+		path := filepath.Join(vault, filepath.FromSlash(name))
+		assert.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+		assert.NoError(t, os.WriteFile(path, []byte(name), 0644))
+	}
+
+	h := newTestImageHandler(t, nil)
+	h.SetDryRun(true)
+	dir := filepath.Join(vault, "notes")
+	content, err := h.ProcessImages(`![[pic.png|100]]`, dir, "")
+	assert.NoError(t, err)
+	assert.Empty(t, content)
+
+	h.obsidian.Enabled = true
+	content, err = h.ProcessImages(`![[pic.png|100]] ![[other/pic.png]]`, dir, "")
+	assert.NoError(t, err)
+	assert.Regexp(t, `^<ac:image ac:width="100"><ri:attachment ri:filename="pic.png"/></ac:image> `+
+		`<ac:image><ri:attachment ri:filename="pic-[0-9a-f]{8}.png"/></ac:image>$`, content)
+}
+
+func TestImageAttachmentVersions(t *testing.T) {
+	dir := t.TempDir()
+	for name, data := range map[string]string{"same.png": "same", "changed.png": "new", "new.png": "fresh"} {
+		assert.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte(data), 0644))
+	}
+
+	var requests []string
+	h := newTestImageHandler(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet {
+			fmt.Fprintf(w, `{"results":[
+				{"id":"att1","title":"same.png","metadata":{"comment":"%s"}},
+				{"id":"att2","title":"changed.png","metadata":{"comment":"%s"}}]}`,
+				attachmentComment(contentHash([]byte("same")), "same.png"), attachmentComment(contentHash([]byte("old")), "changed.png"))
+			return
+		}
+		requests = append(requests, r.URL.Path+" "+attachmentHash(r.FormValue("comment")))
+		w.Write([]byte(`{}`))
+	})
+
+	content, err := h.ProcessImages(`![](same.png)![](changed.png)![](new.png)![](changed.png)`, dir, "42")
+	assert.NoError(t, err)
+	assert.Equal(t, `<ac:image><ri:attachment ri:filename="same.png"/></ac:image>`+
+		`<ac:image><ri:attachment ri:filename="changed.png"/></ac:image>`+
+		`<ac:image><ri:attachment ri:filename="new.png"/></ac:image>`+
+		`<ac:image><ri:attachment ri:filename="changed.png"/></ac:image>`, content)
+	assert.Equal(t, []string{
+		"/rest/api/content/42/child/attachment/att2/data " + contentHash([]byte("new")),
+		"/rest/api/content/42/child/attachment " + contentHash([]byte("fresh")),
+	}, requests)
+}
+
+func TestImageAttachmentNames(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"a/diagram.png", "b/diagram.png", "c/diagram.png"} {
+		assert.NoError(t, os.MkdirAll(filepath.Dir(filepath.Join(dir, name)), 0755))
+		assert.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte(name), 0644))
+	}
+
+	// 页面上已有 b/diagram.png 上传的 diagram.png
+	uploaded := make(map[string]string)
+	h := newTestImageHandler(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet {
+			fmt.Fprintf(w, `{"results":[{"id":"att1","title":"diagram.png","metadata":{"comment":"%s"}}]}`,
+				attachmentComment(contentHash([]byte("b/diagram.png")), "b/diagram.png"))
+			return
+		}
+		file, header, err := r.FormFile("file")
+		assert.NoError(t, err)
+		file.Close()
+		uploaded[header.Filename] = r.FormValue("comment")
+		w.Write([]byte(`{}`))
+	})
+
+	content, err := h.ProcessImages(`![](a/diagram.png)![](b/diagram.png)![](c/diagram.png)![](a/diagram.png)`, dir, "42")
+	assert.NoError(t, err)
+	a, c := attachmentName(t, content, 0), attachmentName(t, content, 2)
+	assert.Regexp(t, `^diagram-[0-9a-f]{8}\.png$`, a)
+	assert.Regexp(t, `^diagram-[0-9a-f]{8}\.png$`, c)
+	assert.NotEqual(t, a, c)
+	assert.Equal(t, "diagram.png", attachmentName(t, content, 1))
+	assert.Equal(t, a, attachmentName(t, content, 3))
+	assert.Len(t, uploaded, 2)
+	assert.Contains(t, uploaded[a], "source:a/diagram.png")
+
+	// 离线渲染不了解页面上的附件，先出现的文件使用原文件名，其余追加相同的路径哈希
+	h.SetDryRun(true)
+	offline, err := h.ProcessImages(`![](a/diagram.png)![](c/diagram.png)![](b/diagram.png)`, dir, "")
+	assert.NoError(t, err)
+	assert.Equal(t, "diagram.png", attachmentName(t, offline, 0))
+	assert.Equal(t, c, attachmentName(t, offline, 1))
+}
+
+// attachmentName 返回内容中第 n 个附件引用的文件名
+func attachmentName(t *testing.T, content string, n int) string {
+	matches := regexp.MustCompile(`ri:filename="([^"]+)"`).FindAllStringSubmatch(content, -1)
+	if !assert.Greater(t, len(matches), n) {
+		return ""
+	}
+	return matches[n][1]
+}
+
+func TestImageRehosting(t *testing.T) {
+	pngData := encodePNG(t, 10, 10)
+	remote := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/img/logo":
+			w.Write(pngData)
+		case "/big.png":
+			w.Write(make([]byte, 2*1024*1024))
+		default:
+			w.Write([]byte("<html>not an image</html>"))
+		}
+	}))
+	defer remote.Close()
+
+	uploaded := make(map[string]string)
+	h := newTestImageHandler(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet {
+			w.Write([]byte(`{"results":[]}`))
+			return
+		}
+		_, header, err := r.FormFile("file")
+		assert.NoError(t, err)
+		uploaded[header.Filename] = r.FormValue("comment")
+		w.Write([]byte(`{}`))
+	})
+	h.images.Rehost = true
+	h.images.MaxSizeMB = 1
+
+	pastedData := encodePNG(t, 12, 12)
+	dataURI := "data:image/png;base64," + base64.StdEncoding.EncodeToString(pastedData)
+	content, err := h.ProcessImages(`<img src="`+remote.URL+`/img/logo" alt=""/>`+
+		`<img src="`+remote.URL+`/page.html" alt=""/>`+
+		`<img src="`+remote.URL+`/big.png" alt=""/>`+
+		`<img src="`+dataURI+`" alt=""/>`+
+		`<img src="data:text/plain;base64,aGVsbG8=" alt=""/>`, "", "42")
+	assert.NoError(t, err)
+
+	dataName := "image-" + contentHash(pastedData)[:8] + ".png"
+	assert.Equal(t, `<ac:image><ri:attachment ri:filename="logo.png"/></ac:image>`+
+		`<ac:image><ri:url ri:value="`+remote.URL+`/page.html"/></ac:image>`+
+		`<ac:image><ri:url ri:value="`+remote.URL+`/big.png"/></ac:image>`+
+		`<ac:image><ri:attachment ri:filename="`+dataName+`"/></ac:image>`, content)
+	assert.Len(t, uploaded, 2)
+	assert.Contains(t, uploaded["logo.png"], "source:"+remote.URL+"/img/logo")
+
+	// 离线渲染时外部图片保留URL引用，data URI图片以相同的附件名引用
+	h.SetDryRun(true)
+	content, err = h.ProcessImages(`<img src="`+remote.URL+`/img/logo" alt=""/><img src="`+dataURI+`" alt=""/>`, "", "")
+	assert.NoError(t, err)
+	assert.Equal(t, `<ac:image><ri:url ri:value="`+remote.URL+`/img/logo"/></ac:image>`+
+		`<ac:image><ri:attachment ri:filename="`+dataName+`"/></ac:image>`, content)
+}
+
+func TestFileLinks(t *testing.T) {
+	dir := t.TempDir()
+	assert.NoError(t, os.MkdirAll(filepath.Join(dir, "files"), 0755))
+	for _, name := range []string{"files/spec.pdf", "app.yaml", "notes.md", "../secret.txt"} {
+		assert.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte(name), 0644))
+	}
+
+	uploaded := make(map[string]bool)
+	h := newTestImageHandler(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet {
+			w.Write([]byte(`{"results":[]}`))
+			return
+		}
+		_, header, err := r.FormFile("file")
+		assert.NoError(t, err)
+		uploaded[header.Filename] = true
+		w.Write([]byte(`{}`))
+	})
+
+	// 默认不处理
+	content, err := h.ProcessImages(`<a href="app.yaml">config</a>`, dir, "42")
+	assert.NoError(t, err)
+	assert.Equal(t, `<a href="app.yaml">config</a>`, content)
+
+	// 目录之外的文件与代码块中的链接保持不变
+	h.attachmentsConfig.Enabled = true
+	code := `<ac:structured-macro ac:name="code"><ac:plain-text-body><![CDATA[<a href="app.yaml">x</a>]]></ac:plain-text-body></ac:structured-macro>`
+	content, err = h.ProcessImages(`<p><a href="./files/spec.pdf">spec</a>, <a href="app.yaml#L3"><code>config</code></a>, `+
+		`<a href="notes.md">notes</a>, <a href="missing.txt">missing</a>, <a href="https://example.com/a.pdf">remote</a>, `+
+		`<a href="../secret.txt">secret</a></p>`+code, dir, "42")
+	assert.NoError(t, err)
+	assert.Equal(t, `<p><ac:link><ri:attachment ri:filename="spec.pdf"/><ac:plain-text-link-body><![CDATA[spec]]></ac:plain-text-link-body></ac:link>, `+
+		`<ac:link><ri:attachment ri:filename="app.yaml"/><ac:link-body><code>config</code></ac:link-body></ac:link>, `+
+		`<a href="notes.md">notes</a>, <a href="missing.txt">missing</a>, <a href="https://example.com/a.pdf">remote</a>, `+
+		`<a href="../secret.txt">secret</a></p>`+code, content)
+	assert.Equal(t, map[string]bool{"spec.pdf": true, "app.yaml": true}, uploaded)
+	assert.NoError(t, ValidateStorage(content, ""))
+
+	h.SetDryRun(true)
+	h.attachmentsConfig.ViewFile = true
+	content, err = h.ProcessImages(`<p><a href="files/spec.pdf">spec</a> <a href="app.yaml">config</a></p>`, dir, "")
+	assert.NoError(t, err)
+	assert.Equal(t, `<p><ac:structured-macro ac:name="view-file"><ac:parameter ac:name="name"><ri:attachment ri:filename="spec.pdf"/></ac:parameter></ac:structured-macro> `+
+		`<ac:link><ri:attachment ri:filename="app.yaml"/><ac:plain-text-link-body><![CDATA[config]]></ac:plain-text-link-body></ac:link></p>`, content)
+
+	// 直接发布的内容没有所在目录，不处理
+	content, err = h.ProcessImages(`<a href="app.yaml">config</a>`, "", "")
+	assert.NoError(t, err)
+	assert.Equal(t, `<a href="app.yaml">config</a>`, content)
+}
+
+func TestAttachmentCache(t *testing.T) {
+	dir := t.TempDir()
+	cachePath := filepath.Join(t.TempDir(), "attachments.json")
+	assert.NoError(t, os.MkdirAll(filepath.Join(dir, "b"), 0755))
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "a.png"), []byte("a"), 0644))
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "b", "a.png"), []byte("a"), 0644))
+
+	// 模拟服务记录每个页面上的附件
+	var requests []string
+	attachments := make(map[string]string) // 键为附件列表地址，值为附件JSON
+	uploads := 0
+	mock := func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r.Method+" "+r.URL.Path)
+		if r.Method == http.MethodPost {
+			uploads++
+			_, header, err := r.FormFile("file")
+			assert.NoError(t, err)
+			attachments[r.URL.Path] = fmt.Sprintf(`{"id":"att%d","title":"%s","metadata":{"comment":"%s"},"version":{"number":1}}`,
+				uploads, header.Filename, r.FormValue("comment"))
+		}
+		fmt.Fprintf(w, `{"results":[%s]}`, attachments[r.URL.Path])
+	}
+	publish := func(content, pageID string) string {
+		requests = nil
+		result, err := newCachedTestImageHandler(t, mock, cachePath).ProcessImages(content, dir, pageID)
+		assert.NoError(t, err)
+		return result
+	}
+
+	assert.Equal(t, `<ac:image><ri:attachment ri:filename="a.png"/></ac:image>`, publish(`![](a.png)`, "42"))
+	assert.Equal(t, []string{"GET /rest/api/content/42/child/attachment", "POST /rest/api/content/42/child/attachment"}, requests)
+
+	// 再次发布只核对附件列表；内容相同的其他文件复用同一附件
+	assert.Equal(t, `<ac:image><ri:attachment ri:filename="a.png"/></ac:image><ac:image><ri:attachment ri:filename="a.png"/></ac:image>`,
+		publish(`![](a.png)![](b/a.png)`, "42"))
+	assert.Equal(t, []string{"GET /rest/api/content/42/child/attachment"}, requests)
+
+	// 其他页面各自上传一份
+	publish(`![](a.png)`, "43")
+	assert.Equal(t, []string{"GET /rest/api/content/43/child/attachment", "POST /rest/api/content/43/child/attachment"}, requests)
+
+	// 附件在页面上被删除后重新上传
+	delete(attachments, "/rest/api/content/42/child/attachment")
+	publish(`![](a.png)`, "42")
+	assert.Equal(t, []string{"GET /rest/api/content/42/child/attachment", "POST /rest/api/content/42/child/attachment"}, requests)
+
+	// 文件内容变化后重新上传
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "a.png"), []byte("changed"), 0644))
+	publish(`![](a.png)`, "42")
+	assert.Contains(t, requests, "POST /rest/api/content/42/child/attachment/att3/data")
+}
+
+// newTestConverter 创建连接到模拟Confluence服务的转换器
+func newTestConverter(t *testing.T, handler http.HandlerFunc) *Converter {
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+
+	cfg := &config.Config{Confluence: config.ConfluenceConfig{URL: server.URL, Space: "DOC"}}
+	cfg.Markdown.Images.Cache = filepath.Join(t.TempDir(), "attachments.json")
+	return NewConverter(cfg)
+}
+
+func TestPublishNewPageAttachments(t *testing.T) {
+	dir := t.TempDir()
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "doc.md"), []byte("![](a.png)\n"), 0644))
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "a.png"), []byte("png"), 0644))
+
+	var requests []string
+	c := newTestConverter(t, func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r.Method+" "+r.URL.Path)
+		switch {
+		case r.Method == http.MethodPost && r.URL.Path == "/rest/api/content":
+			w.Write([]byte(`{"id":"100","title":"Doc"}`))
+		default:
+			w.Write([]byte(`{"results":[]}`))
+		}
+	})
+
+	// 新页面先创建，图片上传到新页面；附件名与创建时一致，无需再更新正文
+	assert.NoError(t, c.Publish(filepath.Join(dir, "doc.md"), "Doc", "7"))
+	assert.Equal(t, []string{
+		"GET /rest/api/content/7/child/page",
+		"POST /rest/api/content",
+		"GET /rest/api/content/100/child/attachment",
+		"POST /rest/api/content/100/child/attachment",
+	}, requests)
+}
+
+func TestCleanParentAttachments(t *testing.T) {
+	comment := confluence.DefaultAttachmentComment
+	var deleted []string
+	c := newTestConverter(t, func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == http.MethodDelete:
+			deleted = append(deleted, r.URL.Path)
+		case r.URL.Path == "/rest/api/content/7/child/attachment":
+			fmt.Fprintf(w, `{"results":[`+
+				`{"id":"1","title":"old.png","metadata":{"comment":"%[1]s (sha256:a, source:old.png)"}},`+
+				`{"id":"2","title":"own.png","metadata":{"comment":"%[1]s"}},`+
+				`{"id":"3","title":"shared.png","metadata":{"comment":"%[1]s"}},`+
+				`{"id":"4","title":"linked.pdf","metadata":{"comment":"%[1]s"}},`+
+				`{"id":"5","title":"manual.png","metadata":{"comment":"uploaded by hand"}},`+
+				`{"id":"6","title":"arch diagram.png","metadata":{"comment":"%[1]s"}}]}`, comment)
+		case r.URL.Path == "/rest/api/content/7/child/page":
+			w.Write([]byte(`{"results":[{"id":"8","title":"Child"}]}`))
+		case r.URL.Path == "/rest/api/content/7":
+			w.Write([]byte(`{"body":{"storage":{"value":"<ac:image><ri:attachment ri:filename=\"own.png\"/></ac:image>` +
+				`<ac:image><ri:url ri:value=\"https://wiki.example.com/download/attachments/7/arch%20diagram.png?version=1\"/></ac:image>"}}}`))
+		case r.URL.Path == "/rest/api/content/8":
+			w.Write([]byte(`{"body":{"storage":{"value":"` +
+				`<ac:image><ri:attachment ri:filename=\"shared.png\"><ri:page ri:content-title=\"Parent\"/></ri:attachment></ac:image>` +
+				`<ac:image><ri:attachment ri:filename=\"old.png\"/></ac:image>` +
+				`<a href=\"/download/attachments/7/linked.pdf\">pdf</a>"}}}`))
+		}
+	})
+
+	removed, err := c.CleanParentAttachments("7", true)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"old.png"}, removed)
+	assert.Empty(t, deleted)
+
+	removed, err = c.CleanParentAttachments("7", false)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"old.png"}, removed)
+	assert.Equal(t, []string{"/rest/api/content/1"}, deleted)
+}
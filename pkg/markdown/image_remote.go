@@ -0,0 +1,211 @@
+package markdown
+
+import (
+	"encoding/base64"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"time"
+)
+
+// imageDownloadTimeout 下载外部图片的超时时间
+const imageDownloadTimeout = 30 * time.Second
+
+// imageExtensions 图片内容类型对应的扩展名
+var imageExtensions = map[string]string{
+	"image/png":     ".png",
+	"image/jpeg":    ".jpg",
+	"image/gif":     ".gif",
+	"image/webp":    ".webp",
+	"image/bmp":     ".bmp",
+	"image/svg+xml": ".svg",
+}
+
+// processEmbeddedImage 将data URI图片解码并上传为附件
+// 参数:
+//   - uri: data URI
+//   - options: 显示选项
+// 返回:
+//   - string: Confluence XML格式的图片标签，失败时为空
+func (h *ImageHandler) processEmbeddedImage(uri string, options imageOptions) string {
+	data, contentType, err := decodeDataURI(uri, h.maxImageBytes())
+	if err != nil {
+		fmt.Fprintf(h.out, "⚠️ 警告: 无法解析data URI图片: %v\n", err)
+		return ""
+	}
+
+	hash := contentHash(data)
+	source := "data:" + hash[:16]
+	basename := "image-" + hash[:8] + imageExtensions[contentType]
+	return h.attachImageContent(basename, source, data, contentType, options)
+}
+
+// processRemoteImage 下载外部图片并上传为附件
+// 参数:
+//   - imageURL: 图片URL
+//   - options: 显示选项
+// 返回:
+//   - string: Confluence XML格式的图片标签，失败时为空（调用方回退为URL引用）
+func (h *ImageHandler) processRemoteImage(imageURL string, options imageOptions) string {
+	data, contentType, err := h.downloadImage(imageURL)
+	if err != nil {
+		fmt.Fprintf(h.out, "⚠️ 警告: 下载外部图片失败，保留URL引用 %s: %v\n", imageURL, err)
+		return ""
+	}
+	return h.attachImageContent(remoteImageName(imageURL, contentType), imageURL, data, contentType, options)
+}
+
+// attachImageContent 上传图片内容并生成附件引用
+func (h *ImageHandler) attachImageContent(basename, source string, data []byte, contentType string, options imageOptions) string {
+	if !options.explicit {
+		if width, height, err := readImageSize(data); err == nil {
+			options.size = fitImageSize(width, height, h.maxWidth, h.maxHeight, h.minScale)
+		}
+	}
+
+	if h.dryRun {
+		return imageMacro(options, h.attachmentReference(h.attachmentName(basename, source)))
+	}
+
+	filename, err := h.uploadContent(basename, source, data, contentType)
+	if err != nil {
+		fmt.Fprintf(h.out, "⚠️ 警告: 图片上传失败 %s: %v\n", basename, err)
+		return ""
+	}
+	return imageMacro(options, h.attachmentReference(filename))
+}
+
+// downloadImage 下载外部图片，限制大小并校验内容类型
+// 参数:
+//   - imageURL: 图片URL
+// 返回:
+//   - []byte: 图片内容
+//   - string: 内容类型
+//   - error: 下载失败、超出大小或不是图片时的错误
+func (h *ImageHandler) downloadImage(imageURL string) ([]byte, string, error) {
+	client := &http.Client{Timeout: imageDownloadTimeout}
+	resp, err := client.Get(imageURL)
+	if err != nil {
+		return nil, "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, "", fmt.Errorf("服务器返回 %s", resp.Status)
+	}
+
+	limit := h.maxImageBytes()
+	if resp.ContentLength > limit {
+		return nil, "", fmt.Errorf("图片大小 %d 字节超过上限 %d 字节", resp.ContentLength, limit)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, limit+1))
+	if err != nil {
+		return nil, "", err
+	}
+	if int64(len(data)) > limit {
+		return nil, "", fmt.Errorf("图片大小超过上限 %d 字节", limit)
+	}
+
+	contentType, ok := sniffImageType(data, resp.Header.Get("Content-Type"))
+	if !ok {
+		return nil, "", fmt.Errorf("内容不是图片 (%s)", contentType)
+	}
+	return data, contentType, nil
+}
+
+// maxImageBytes 返回下载与解码图片的大小上限
+func (h *ImageHandler) maxImageBytes() int64 {
+	return int64(h.images.MaxSizeMB) * 1024 * 1024
+}
+
+// decodeDataURI 解码 data URI（支持base64与百分号编码）
+// 参数:
+//   - uri: data URI
+//   - limit: 大小上限（字节）
+// 返回:
+//   - []byte: 解码后的内容
+//   - string: 根据内容识别的图片类型
+//   - error: 格式错误、超出大小或不是图片时的错误
+func decodeDataURI(uri string, limit int64) ([]byte, string, error) {
+	header, payload, ok := strings.Cut(strings.TrimPrefix(uri, "data:"), ",")
+	if !ok {
+		return nil, "", fmt.Errorf("缺少数据部分")
+	}
+
+	// 粗略检查编码前的长度，避免解码过大的内容
+	if int64(len(payload))*3/4 > limit {
+		return nil, "", fmt.Errorf("图片大小超过上限 %d 字节", limit)
+	}
+
+	var data []byte
+	var err error
+	if strings.HasSuffix(strings.ToLower(header), ";base64") {
+		payload = strings.Map(func(r rune) rune {
+			if r == ' ' || r == '\n' || r == '\r' || r == '\t' {
+				return -1
+			}
+			return r
+		}, payload)
+		data, err = base64.StdEncoding.DecodeString(payload)
+		if err != nil {
+			data, err = base64.RawStdEncoding.DecodeString(strings.TrimRight(payload, "="))
+		}
+		header = header[:len(header)-len(";base64")]
+	} else {
+		var unescaped string
+		unescaped, err = url.PathUnescape(payload)
+		data = []byte(unescaped)
+	}
+	if err != nil {
+		return nil, "", fmt.Errorf("解码失败: %w", err)
+	}
+	if int64(len(data)) > limit {
+		return nil, "", fmt.Errorf("图片大小超过上限 %d 字节", limit)
+	}
+
+	contentType, ok := sniffImageType(data, header)
+	if !ok {
+		return nil, "", fmt.Errorf("内容不是图片 (%s)", contentType)
+	}
+	return data, contentType, nil
+}
+
+// sniffImageType 根据内容识别图片类型，无法识别时参考声明的类型（如SVG）
+// 参数:
+//   - data: 内容
+//   - declared: 声明的内容类型
+// 返回:
+//   - string: 内容类型
+//   - bool: 是否为图片
+func sniffImageType(data []byte, declared string) (string, bool) {
+	detected := http.DetectContentType(data)
+	if strings.HasPrefix(detected, "image/") {
+		return detected, true
+	}
+
+	// SVG 会被识别为文本或XML
+	mediaType, _, _ := mime.ParseMediaType(declared)
+	if mediaType == "image/svg+xml" && strings.Contains(string(data[:min(len(data), 1024)]), "<svg") {
+		return mediaType, true
+	}
+	return detected, false
+}
+
+// remoteImageName 根据URL路径生成附件文件名，缺少扩展名时按内容类型补充
+func remoteImageName(imageURL, contentType string) string {
+	name := "image"
+	if parsed, err := url.Parse(imageURL); err == nil {
+		if base := path.Base(parsed.Path); base != "." && base != "/" && base != "" {
+			name = base
+		}
+	}
+	if ext := imageExtensions[contentType]; ext != "" && !strings.EqualFold(path.Ext(name), ext) &&
+		!(ext == ".jpg" && strings.EqualFold(path.Ext(name), ".jpeg")) {
+		name += ext
+	}
+	return name
+}
@@ -0,0 +1,180 @@
+package markdown
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"image"
+	"image/color"
+	_ "image/gif" // 注册GIF解码器，用于读取尺寸
+	"image/jpeg"
+	"image/png"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// imageSize 图片的显示尺寸，为0的一边不指定
+type imageSize struct {
+	width  int
+	height int
+}
+
+// parseImageSize 解析图片路径后的尺寸说明，如 400、400x300、x300
+// 参数:
+//   - spec: 尺寸说明
+// 返回:
+//   - imageSize: 解析后的尺寸
+//   - bool: 是否为有效的尺寸说明
+func parseImageSize(spec string) (imageSize, bool) {
+	spec = strings.ToLower(strings.TrimSpace(spec))
+	widthSpec, heightSpec, _ := strings.Cut(spec, "x")
+
+	var size imageSize
+	var err error
+	if widthSpec != "" {
+		if size.width, err = strconv.Atoi(widthSpec); err != nil || size.width <= 0 {
+			return imageSize{}, false
+		}
+	}
+	if heightSpec != "" {
+		if size.height, err = strconv.Atoi(heightSpec); err != nil || size.height <= 0 {
+			return imageSize{}, false
+		}
+	}
+	return size, size.width > 0 || size.height > 0
+}
+
+// readImageSize 读取PNG、JPEG、GIF或WebP图片的像素尺寸
+// 参数:
+//   - data: 图片内容
+// 返回:
+//   - int: 宽度
+//   - int: 高度
+//   - error: 无法识别格式时的错误
+func readImageSize(data []byte) (int, int, error) {
+	if width, height, ok := readWebPSize(data); ok {
+		return width, height, nil
+	}
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return 0, 0, err
+	}
+	return cfg.Width, cfg.Height, nil
+}
+
+// readWebPSize 从WebP文件头读取尺寸（支持 VP8、VP8L 与 VP8X）
+func readWebPSize(data []byte) (int, int, bool) {
+	if len(data) < 30 || string(data[0:4]) != "RIFF" || string(data[8:12]) != "WEBP" {
+		return 0, 0, false
+	}
+
+	switch string(data[12:16]) {
+	case "VP8 ":
+		// 关键帧头之后是14位的宽高
+		width := int(binary.LittleEndian.Uint16(data[26:28]) & 0x3fff)
+		height := int(binary.LittleEndian.Uint16(data[28:30]) & 0x3fff)
+		return width, height, true
+	case "VP8L":
+		b := data[21:25]
+		width := 1 + (int(b[0]) | int(b[1]&0x3f)<<8)
+		height := 1 + (int(b[1])>>6 | int(b[2])<<2 | int(b[3]&0x0f)<<10)
+		return width, height, true
+	case "VP8X":
+		width := 1 + (int(data[24]) | int(data[25])<<8 | int(data[26])<<16)
+		height := 1 + (int(data[27]) | int(data[28])<<8 | int(data[29])<<16)
+		return width, height, true
+	}
+	return 0, 0, false
+}
+
+// fitImageSize 计算适合显示范围的尺寸
+// 参数:
+//   - width, height: 图片原始尺寸
+//   - maxWidth, maxHeight: 最大显示尺寸
+//   - minScale: 最小缩放比例，避免图片缩得过小而无法辨认
+// 返回:
+//   - imageSize: 显示尺寸，无需缩放时为空
+func fitImageSize(width, height, maxWidth, maxHeight int, minScale float64) imageSize {
+	if width <= 0 || height <= 0 {
+		return imageSize{}
+	}
+	scale := math.Min(float64(maxWidth)/float64(width), float64(maxHeight)/float64(height))
+	if scale >= 1 {
+		return imageSize{}
+	}
+	scale = math.Max(scale, minScale)
+	return imageSize{
+		width:  max(int(math.Round(float64(width)*scale)), 1),
+		height: max(int(math.Round(float64(height)*scale)), 1),
+	}
+}
+
+// shrinkImage 将超出范围的PNG或JPEG图片等比缩小并重新压缩
+// 参数:
+//   - data: 图片内容
+//   - maxWidth, maxHeight: 最大像素尺寸
+//   - quality: JPEG压缩质量
+// 返回:
+//   - []byte: 处理后的图片内容
+//   - bool: 是否进行了缩小
+//   - error: 解码或编码失败时的错误
+func shrinkImage(data []byte, maxWidth, maxHeight, quality int) ([]byte, bool, error) {
+	cfg, format, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, false, err
+	}
+	// GIF可能是动画，保持原样
+	if format != "png" && format != "jpeg" {
+		return data, false, nil
+	}
+	if cfg.Width <= maxWidth && cfg.Height <= maxHeight {
+		return data, false, nil
+	}
+
+	src, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, false, err
+	}
+	scale := math.Min(float64(maxWidth)/float64(cfg.Width), float64(maxHeight)/float64(cfg.Height))
+	dst := scaleImage(src, max(int(float64(cfg.Width)*scale), 1), max(int(float64(cfg.Height)*scale), 1))
+
+	var buf bytes.Buffer
+	if format == "jpeg" {
+		err = jpeg.Encode(&buf, dst, &jpeg.Options{Quality: quality})
+	} else {
+		err = (&png.Encoder{CompressionLevel: png.BestCompression}).Encode(&buf, dst)
+	}
+	if err != nil {
+		return nil, false, fmt.Errorf("重新压缩图片失败: %w", err)
+	}
+	return buf.Bytes(), true, nil
+}
+
+// scaleImage 以区域平均的方式缩小图片
+func scaleImage(src image.Image, width, height int) *image.NRGBA {
+	bounds := src.Bounds()
+	dst := image.NewNRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		y0 := bounds.Min.Y + y*bounds.Dy()/height
+		y1 := max(bounds.Min.Y+(y+1)*bounds.Dy()/height, y0+1)
+		for x := 0; x < width; x++ {
+			x0 := bounds.Min.X + x*bounds.Dx()/width
+			x1 := max(bounds.Min.X+(x+1)*bounds.Dx()/width, x0+1)
+
+			// 预乘alpha下求平均，避免透明像素的颜色渗入
+			var r, g, b, a, n uint64
+			for sy := y0; sy < y1; sy++ {
+				for sx := x0; sx < x1; sx++ {
+					pr, pg, pb, pa := src.At(sx, sy).RGBA()
+					r, g, b, a = r+uint64(pr), g+uint64(pg), b+uint64(pb), a+uint64(pa)
+					n++
+				}
+			}
+			dst.Set(x, y, color.RGBA64{
+				R: uint16(r / n), G: uint16(g / n), B: uint16(b / n), A: uint16(a / n),
+			})
+		}
+	}
+	return dst
+}
@@ -0,0 +1,68 @@
+package markdown
+
+import (
+	"bytes"
+	"image"
+	"image/png"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// encodePNG 生成指定尺寸的PNG图片
+func encodePNG(t *testing.T, width, height int) []byte {
+	var buf bytes.Buffer
+	assert.NoError(t, png.Encode(&buf, image.NewNRGBA(image.Rect(0, 0, width, height))))
+	return buf.Bytes()
+}
+
+func TestImageSizes(t *testing.T) {
+	size, ok := parseImageSize("400x300")
+	assert.True(t, ok)
+	assert.Equal(t, imageSize{width: 400, height: 300}, size)
+	size, ok = parseImageSize("x300")
+	assert.True(t, ok)
+	assert.Equal(t, imageSize{height: 300}, size)
+	_, ok = parseImageSize("wide")
+	assert.False(t, ok)
+
+	assert.Equal(t, imageSize{}, fitImageSize(500, 300, 600, 400, 0.6))
+	assert.Equal(t, imageSize{width: 600, height: 300}, fitImageSize(800, 400, 600, 400, 0.6))
+	assert.Equal(t, imageSize{width: 720, height: 480}, fitImageSize(1200, 800, 600, 400, 0.6))
+
+	// VP8X 扩展格式，宽高以 24 位减一存储
+	webp := append([]byte("RIFF\x00\x00\x00\x00WEBPVP8X"), make([]byte, 14)...)
+	copy(webp[24:], []byte{0x1f, 0x03, 0x00, 0x57, 0x02, 0x00})
+	width, height, err := readImageSize(webp)
+	assert.NoError(t, err)
+	assert.Equal(t, []int{800, 600}, []int{width, height})
+
+	width, height, err = readImageSize(encodePNG(t, 30, 20))
+	assert.NoError(t, err)
+	assert.Equal(t, []int{30, 20}, []int{width, height})
+
+	shrunk, resized, err := shrinkImage(encodePNG(t, 400, 100), 200, 200, 85)
+	assert.NoError(t, err)
+	assert.True(t, resized)
+	width, height, _ = readImageSize(shrunk)
+	assert.Equal(t, []int{200, 50}, []int{width, height})
+	_, resized, _ = shrinkImage(encodePNG(t, 100, 100), 200, 200, 85)
+	assert.False(t, resized)
+}
+
+func TestImageDisplaySize(t *testing.T) {
+	dir := t.TempDir()
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "big.png"), encodePNG(t, 1000, 500), 0644))
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "small.png"), encodePNG(t, 100, 50), 0644))
+
+	h := NewImageHandler(nil, nil)
+	h.SetDryRun(true)
+	content, err := h.ProcessImages(`<img src="big.png" alt=""/><img src="big.png%7C400x300" alt=""/><img src="small.png" alt=""/>![[small.png|80]]`, dir, "")
+	assert.NoError(t, err)
+	assert.Equal(t, `<ac:image ac:width="600" ac:height="300"><ri:attachment ri:filename="big.png"/></ac:image>`+
+		`<ac:image ac:width="400" ac:height="300"><ri:attachment ri:filename="big.png"/></ac:image>`+
+		`<ac:image><ri:attachment ri:filename="small.png"/></ac:image>`+
+		`<ac:image ac:width="80"><ri:attachment ri:filename="small.png"/></ac:image>`, content)
+}
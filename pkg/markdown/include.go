@@ -0,0 +1,175 @@
+package markdown
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var (
+	// {{< include "snippets/setup.md" >}} or {{< include "setup.md" shift=1 >}}
+	includeDirective = regexp.MustCompile(`^\{\{<\s*include\s+"([^"]+)"(?:\s+shift=(\d+))?\s*>\}\}$`)
+	// Obsidian-style transclusion: ![[note]] or ![[note.md]]
+	wikiIncludeDirective = regexp.MustCompile(`^!\[\[([^\]|#]+)\]\]$`)
+	atxHeading           = regexp.MustCompile(`^(#{1,6})(\s.*)?$`)
+	markdownImage        = regexp.MustCompile(`(!\[[^\]]*\]\(\s*<?)([^)\s>]+)`)
+	htmlImage            = regexp.MustCompile(`(<img\b[^>]*?\ssrc=["'])([^"']+)`)
+)
+
+// ResolveIncludes expands include directives relative to baseDir, the directory
+// of the source file. Headings of an included file are shifted below the heading
+// the directive appears under (or by an explicit shift=N), and relative image paths
+// are rewritten so they still resolve from baseDir.
+func (p *Preprocessor) ResolveIncludes(content, baseDir string) (string, error) {
+	return p.expandIncludes(content, baseDir, baseDir, 0, nil)
+}
+
+// expandIncludes expands the includes of one file whose headings are shifted by shift.
+// stack holds the absolute paths of the files currently being included.
+func (p *Preprocessor) expandIncludes(content, dir, rootDir string, shift int, stack []string) (string, error) {
+	lines := strings.Split(content, "\n")
+	inCode := codeFenceMask(lines)
+	result := make([]string, 0, len(lines))
+	level := 0 // level of the most recent heading, after shifting
+
+	for i, line := range lines {
+		if inCode[i] {
+			result = append(result, line)
+			continue
+		}
+
+		trimmed := strings.TrimSpace(line)
+		if m := atxHeading.FindStringSubmatch(line); m != nil {
+			level = min(len(m[1])+shift, 6)
+			result = append(result, strings.Repeat("#", level)+m[2])
+			continue
+		}
+
+		target, childShift, ok := p.parseInclude(trimmed, dir, level)
+		if !ok {
+			result = append(result, line)
+			continue
+		}
+
+		included, err := p.includeFile(target, rootDir, childShift, stack)
+		if err != nil {
+			return "", err
+		}
+		result = append(result, included)
+	}
+
+	return strings.Join(result, "\n"), nil
+}
+
+// parseInclude recognises an include directive line and returns the target path
+// and the heading shift for the included content.
+func (p *Preprocessor) parseInclude(line, dir string, level int) (string, int, bool) {
+	if m := includeDirective.FindStringSubmatch(line); m != nil {
+		shift := level
+		if m[2] != "" {
+			shift, _ = strconv.Atoi(m[2])
+		}
+		return resolveIncludePath(m[1], dir), shift, true
+	}
+
+	if m := wikiIncludeDirective.FindStringSubmatch(line); m != nil {
+		name := strings.TrimSpace(m[1])
+		switch strings.ToLower(filepath.Ext(name)) {
+		case "":
+			name += ".md"
+		case ".md":
+		default:
+			// Non-markdown embeds such as images are not transclusions
+			return "", 0, false
+		}
+
+		target := resolveIncludePath(name, dir)
+		if _, err := os.Stat(target); err != nil && p.vault != nil {
+			if found, ok := loadObsidianVault(findVaultRoot(p.vault.Vault, dir)).resolve(name); ok {
+				target = found
+			}
+		}
+		if _, err := os.Stat(target); err != nil {
+			fmt.Fprintf(p.out, "⚠️ 警告: 未找到嵌入的笔记 %s，保留原文\n", m[1])
+			return "", 0, false
+		}
+		return target, level, true
+	}
+
+	return "", 0, false
+}
+
+// includeFile reads an included file, rewrites its image paths relative to rootDir
+// and expands its own includes.
+func (p *Preprocessor) includeFile(target, rootDir string, shift int, stack []string) (string, error) {
+	absTarget, err := filepath.Abs(target)
+	if err != nil {
+		return "", fmt.Errorf("解析包含文件路径失败: %w", err)
+	}
+	for i, included := range stack {
+		if included == absTarget {
+			chain := append(append([]string{}, stack[i:]...), absTarget)
+			return "", fmt.Errorf("检测到循环包含: %s", strings.Join(chain, " -> "))
+		}
+	}
+
+	data, err := os.ReadFile(target)
+	if err != nil {
+		return "", fmt.Errorf("读取包含文件失败: %w", err)
+	}
+
+	content := strings.ReplaceAll(string(data), "\r\n", "\n")
+	content = strings.TrimRight(p.StripFrontMatter(content), "\n")
+	content = rewriteImagePaths(content, filepath.Dir(target), rootDir)
+
+	return p.expandIncludes(content, filepath.Dir(target), rootDir, shift, append(stack, absTarget))
+}
+
+// resolveIncludePath resolves an include target relative to the including file
+func resolveIncludePath(target, dir string) string {
+	if filepath.IsAbs(target) {
+		return target
+	}
+	return filepath.Join(dir, filepath.FromSlash(target))
+}
+
+// rewriteImagePaths rewrites relative image paths of content located in dir
+// so that they resolve from rootDir. Code blocks are left untouched.
+func rewriteImagePaths(content, dir, rootDir string) string {
+	if filepath.Clean(dir) == filepath.Clean(rootDir) {
+		return content
+	}
+
+	rewrite := func(re *regexp.Regexp, line string) string {
+		return re.ReplaceAllStringFunc(line, func(match string) string {
+			m := re.FindStringSubmatch(match)
+			path := m[2]
+			if isRemoteOrAbsolute(path) {
+				return match
+			}
+			rel, err := filepath.Rel(rootDir, filepath.Join(dir, filepath.FromSlash(path)))
+			if err != nil {
+				return match
+			}
+			return m[1] + filepath.ToSlash(rel)
+		})
+	}
+
+	lines := strings.Split(content, "\n")
+	inCode := codeFenceMask(lines)
+	for i, line := range lines {
+		if !inCode[i] {
+			lines[i] = rewrite(htmlImage, rewrite(markdownImage, line))
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// isRemoteOrAbsolute reports whether an image path must not be rewritten
+func isRemoteOrAbsolute(path string) bool {
+	return strings.Contains(path, "://") || strings.HasPrefix(path, "data:") ||
+		strings.HasPrefix(path, "/") || strings.HasPrefix(path, "#") || filepath.IsAbs(path)
+}
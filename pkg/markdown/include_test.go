@@ -0,0 +1,64 @@
+package markdown
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/HelloAnner/markdown-sync-confluence/pkg/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestResolveIncludes(t *testing.T) {
+	dir := t.TempDir()
+	writeFile := func(name, content string) {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		assert.NoError(t, os.MkdirAll(filepath.Dir(path), 0o755))
+		assert.NoError(t, os.WriteFile(path, []byte(content), 0o644))
+	}
+	writeFile("snippets/setup.md", "---\ntitle: x\n---\n# Setup\n\n![diagram](img/a.png)\n\n![[note]]\n")
+	writeFile("snippets/note.md", "## Note\n\n```\n# not a heading\n```\n")
+
+	p := NewPreprocessor()
+	result, err := p.ResolveIncludes("# Doc\n\n## Install\n\n{{< include \"snippets/setup.md\" >}}\n\n```\n{{< include \"snippets/setup.md\" >}}\n```\n", dir)
+	assert.NoError(t, err)
+	assert.Equal(t, "# Doc\n\n## Install\n\n### Setup\n\n![diagram](snippets/img/a.png)\n\n##### Note\n\n```\n# not a heading\n```\n\n```\n{{< include \"snippets/setup.md\" >}}\n```\n", result)
+
+	result, err = p.ResolveIncludes("## A\n\n{{< include \"snippets/note.md\" shift=0 >}}\n", dir)
+	assert.NoError(t, err)
+	assert.Contains(t, result, "\n## Note\n")
+
+	writeFile("a.md", "{{< include \"b.md\" >}}\n")
+	writeFile("b.md", "![[a]]\n")
+	_, err = p.ResolveIncludes("{{< include \"a.md\" >}}\n", dir)
+	assert.ErrorContains(t, err, "循环包含")
+}
+
+func TestResolveIncludesFromVault(t *testing.T) {
+	vault := t.TempDir()
+	for name, content := range map[string]string{
+		".obsidian/app.json":     "{}",
+		"notes/doc.md":           "",
+		"shared/deep/Snippet.md": "Shared text\n",
+		".trash/Snippet.md":      "Deleted\n",
+	} {
+		path := filepath.Join(vault, filepath.FromSlash(name))
+		assert.NoError(t, os.MkdirAll(filepath.Dir(path), 0o755))
+		assert.NoError(t, os.WriteFile(path, []byte(content), 0o644))
+	}
+
+	p := NewPreprocessor()
+	var out bytes.Buffer
+	p.SetOutput(&out)
+	dir := filepath.Join(vault, "notes")
+	result, err := p.ResolveIncludes("![[Snippet]]\n", dir)
+	assert.NoError(t, err)
+	assert.Equal(t, "![[Snippet]]\n", result)
+	assert.Contains(t, out.String(), "未找到嵌入的笔记 Snippet")
+
+	p.SetObsidian(config.ObsidianConfig{Enabled: true})
+	result, err = p.ResolveIncludes("![[Snippet]]\n", dir)
+	assert.NoError(t, err)
+	assert.Equal(t, "Shared text\n", result)
+}
@@ -0,0 +1,170 @@
+package markdown
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode"
+
+	"github.com/HelloAnner/markdown-sync-confluence/pkg/config"
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/parser"
+	"github.com/yuin/goldmark/renderer"
+	"github.com/yuin/goldmark/text"
+	"github.com/yuin/goldmark/util"
+)
+
+// jiraKeyPattern 问题编号格式
+var jiraKeyPattern = regexp.MustCompile(`^[A-Z][A-Z0-9_]*-[0-9]+$`)
+
+// kindJiraIssue Jira问题节点类型
+var kindJiraIssue = ast.NewNodeKind("JiraIssue")
+
+// jiraIssue Jira问题引用
+type jiraIssue struct {
+	ast.BaseInline
+	key string
+}
+
+// Kind 实现 ast.Node
+func (n *jiraIssue) Kind() ast.NodeKind { return kindJiraIssue }
+
+// Dump 实现 ast.Node
+func (n *jiraIssue) Dump(source []byte, level int) {
+	ast.DumpHelper(n, source, level, map[string]string{"Key": n.key}, nil)
+}
+
+// jiraExtension 将Jira问题引用渲染为jira宏
+type jiraExtension struct {
+	config config.JiraConfig
+	bare   *regexp.Regexp // 裸问题编号匹配规则，为nil时只转换 [[jira:KEY]]
+}
+
+// newJiraExtension 创建Jira扩展
+// 参数:
+//   - cfg: Jira配置
+// 返回:
+//   - *jiraExtension: 扩展实例
+//   - error: 项目键正则无效时的错误
+func newJiraExtension(cfg config.JiraConfig) (*jiraExtension, error) {
+	extension := &jiraExtension{config: cfg}
+	if len(cfg.Projects) == 0 {
+		return extension, nil
+	}
+
+	bare, err := regexp.Compile(`^(?:` + strings.Join(cfg.Projects, "|") + `)-[0-9]+`)
+	if err != nil {
+		return extension, fmt.Errorf("无效的Jira项目键: %w", err)
+	}
+	extension.bare = bare
+	return extension, nil
+}
+
+// Extend 实现 goldmark.Extender
+func (e *jiraExtension) Extend(m goldmark.Markdown) {
+	// [[jira:KEY]] 需先于链接解析器处理 [
+	parsers := []util.PrioritizedValue{util.Prioritized(&jiraWikiParser{}, 199)}
+	if e.bare != nil {
+		parsers = append(parsers, util.Prioritized(&jiraKeyParser{pattern: e.bare}, 200))
+	}
+	m.Parser().AddOptions(parser.WithInlineParsers(parsers...))
+	m.Renderer().AddOptions(
+		renderer.WithNodeRenderers(util.Prioritized(&jiraRenderer{config: e.config}, 200)),
+	)
+}
+
+// jiraWikiParser 解析 [[jira:PROJ-123]]
+type jiraWikiParser struct{}
+
+// Trigger 实现 parser.InlineParser
+func (p *jiraWikiParser) Trigger() []byte {
+	return []byte{'['}
+}
+
+// Parse 实现 parser.InlineParser
+func (p *jiraWikiParser) Parse(parent ast.Node, block text.Reader, pc parser.Context) ast.Node {
+	line, _ := block.PeekLine()
+	if !bytes.HasPrefix(line, []byte("[[jira:")) {
+		return nil
+	}
+	end := bytes.Index(line, []byte("]]"))
+	if end < 0 {
+		return nil
+	}
+	key := strings.TrimSpace(string(line[len("[[jira:"):end]))
+	if !jiraKeyPattern.MatchString(key) {
+		return nil
+	}
+	block.Advance(end + 2)
+	return &jiraIssue{key: key}
+}
+
+// jiraKeyParser 解析匹配已配置项目的裸问题编号，前后紧邻字母或数字时不转换
+// 与linkify相同，Goldmark只在空白、标点和行首调用解析器，因此以空格和括号触发
+type jiraKeyParser struct {
+	pattern *regexp.Regexp
+}
+
+// Trigger 实现 parser.InlineParser
+func (p *jiraKeyParser) Trigger() []byte {
+	return []byte{' ', '('}
+}
+
+// Parse 实现 parser.InlineParser
+func (p *jiraKeyParser) Parse(parent ast.Node, block text.Reader, pc parser.Context) ast.Node {
+	if pc.IsInLinkLabel() {
+		return nil
+	}
+	line, segment := block.PeekLine()
+	consumes := 0
+	if line[0] == ' ' || line[0] == '(' {
+		consumes = 1
+		line = line[1:]
+	} else if prev := block.PrecendingCharacter(); unicode.IsLetter(prev) || unicode.IsDigit(prev) || prev == '-' || prev == '/' {
+		return nil
+	}
+
+	loc := p.pattern.FindIndex(line)
+	if loc == nil {
+		return nil
+	}
+	if loc[1] < len(line) {
+		if next := rune(line[loc[1]]); unicode.IsLetter(next) || unicode.IsDigit(next) || next == '-' || next == '_' {
+			return nil
+		}
+	}
+
+	if consumes != 0 {
+		ast.MergeOrAppendTextSegment(parent, segment.WithStop(segment.Start+1))
+	}
+	block.Advance(consumes + loc[1])
+	return &jiraIssue{key: string(line[:loc[1]])}
+}
+
+// jiraRenderer 将Jira问题节点渲染为jira宏
+type jiraRenderer struct {
+	config config.JiraConfig
+}
+
+// RegisterFuncs 实现 renderer.NodeRenderer
+func (r *jiraRenderer) RegisterFuncs(reg renderer.NodeRendererFuncRegisterer) {
+	reg.Register(kindJiraIssue, r.renderJiraIssue)
+}
+
+func (r *jiraRenderer) renderJiraIssue(w util.BufWriter, source []byte, node ast.Node, entering bool) (ast.WalkStatus, error) {
+	if !entering {
+		return ast.WalkSkipChildren, nil
+	}
+
+	params := map[string]string{"key": node.(*jiraIssue).key}
+	if r.config.Server != "" {
+		params["server"] = r.config.Server
+	}
+	if r.config.ServerID != "" {
+		params["serverId"] = r.config.ServerID
+	}
+	_, _ = w.WriteString(buildMacro("jira", params, ""))
+	return ast.WalkSkipChildren, nil
+}
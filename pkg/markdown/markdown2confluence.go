@@ -2,8 +2,10 @@ package markdown
 
 import (
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
+	"strings"
 
 	"github.com/HelloAnner/markdown-sync-confluence/pkg/config"
 	"github.com/HelloAnner/markdown-sync-confluence/pkg/confluence"
@@ -17,6 +19,7 @@ type Converter struct {
 	imageHandler    *ImageHandler         // 图片处理器
 	preprocessor    *Preprocessor         // 预处理器
 	currentPageID   string                // 当前正在处理的页面ID
+	out             io.Writer             // 进度信息的输出
 }
 
 // NewConverter 创建一个新的Markdown转Confluence转换器
@@ -26,16 +29,48 @@ type Converter struct {
 //   - *Converter: 转换器实例
 func NewConverter(config *config.Config) *Converter {
 	confluenceClient := confluence.NewClient(config)
+	contentHandler := NewContentHandler(config)
+	contentHandler.SetUserResolver(confluenceClient.GetUser)
+	preprocessor := NewPreprocessor()
+	preprocessor.Pipeline().Configure(config.Markdown.Pipeline)
+	preprocessor.SetObsidian(config.Markdown.Obsidian)
 	
 	return &Converter{
 		config:          config,
 		confluenceClient: confluenceClient,
-		contentHandler:  NewContentHandler(),
+		contentHandler:  contentHandler,
 		imageHandler:    NewImageHandler(confluenceClient, config),
-		preprocessor:    NewPreprocessor(),
+		preprocessor:    preprocessor,
+		out:             os.Stdout,
 	}
 }
 
+// SetOutput 设置进度与警告信息的输出位置（默认为标准输出），
+// 同时作用于内容、图片与预处理器
+// 参数:
+//   - w: 输出目标
+func (c *Converter) SetOutput(w io.Writer) {
+	c.out = w
+	c.contentHandler.SetOutput(w)
+	c.imageHandler.SetOutput(w)
+	c.preprocessor.SetOutput(w)
+}
+
+// Pipeline 返回内容转换流水线，可注册自定义的Markdown与存储格式步骤
+// 需要在front matter移除之前处理源文本时使用 Preprocessor().Pipeline()
+// 返回:
+//   - *Pipeline: 转换流水线
+func (c *Converter) Pipeline() *Pipeline {
+	return c.contentHandler.Pipeline()
+}
+
+// Preprocessor 返回预处理器
+// 返回:
+//   - *Preprocessor: 预处理器
+func (c *Converter) Preprocessor() *Preprocessor {
+	return c.preprocessor
+}
+
 // Publish 将Markdown文件转换并发布到Confluence
 // 参数:
 //   - markdownFile: Markdown文件路径
@@ -44,89 +79,90 @@ func NewConverter(config *config.Config) *Converter {
 // 返回:
 //   - error: 处理过程中的错误
 func (c *Converter) Publish(markdownFile, title, parentPageID string) error {
+	content, markdownDir, err := c.readMarkdownFile(markdownFile)
+	if err != nil {
+		return err
+	}
+	
+	return c.publish(content, markdownDir, title, parentPageID)
+}
+
+// readMarkdownFile 读取Markdown文件并展开其中包含的文件
+// 参数:
+//   - markdownFile: Markdown文件路径
+// 返回:
+//   - string: 展开包含后的内容
+//   - string: Markdown文件所在目录（用于解析相对图片路径）
+//   - error: 读取或展开失败时的错误
+func (c *Converter) readMarkdownFile(markdownFile string) (string, string, error) {
 	// 获取Markdown文件目录（用于解析相对图片路径）
 	markdownDir := filepath.Dir(markdownFile)
 	
 	// 读取Markdown内容
 	content, err := os.ReadFile(markdownFile)
 	if err != nil {
-		return fmt.Errorf("读取Markdown文件失败: %w", err)
+		return "", "", fmt.Errorf("读取Markdown文件失败: %w", err)
 	}
 	
-	// 预处理内容
-	processedContent := c.preprocessor.Process(string(content))
-	
-	// 如果命令行未指定父页面ID，使用配置中的值
-	if parentPageID == "" && c.config.Confluence.ParentPageID != "" {
-		parentPageID = c.config.Confluence.ParentPageID
-	}
-	
-	// 父页面ID必须指定
-	if parentPageID == "" {
-		return fmt.Errorf("必须指定父页面ID")
-	}
-	
-	// 在父页面中查找现有页面
-	existingPage, err := c.confluenceClient.FindPageInParent(title, parentPageID)
+	// 展开包含的文件（相对于Markdown文件所在目录）
+	resolvedContent, err := c.preprocessor.ResolveIncludes(string(content), markdownDir)
 	if err != nil {
-		fmt.Printf("⚠️ 警告: 查找现有页面时出错: %s\n", err)
-	}
-	
-	// 如果页面已存在，记录其ID
-	if existingPage != nil {
-		c.currentPageID = existingPage.ID
+		return "", "", fmt.Errorf("处理包含文件失败: %w", err)
 	}
 	
-	// 1. 先转换文本为Confluence格式
-	htmlContent, err := c.contentHandler.ConvertToConfluence(processedContent)
+	return resolvedContent, markdownDir, nil
+}
+
+// RenderFile 离线将Markdown文件转换为存储格式，本地图片以附件文件名引用，不连接Confluence
+// 参数:
+//   - markdownFile: Markdown文件路径
+// 返回:
+//   - string: 存储格式内容
+//   - error: 转换或校验失败时的错误
+func (c *Converter) RenderFile(markdownFile string) (string, error) {
+	htmlContent, markdownDir, err := c.renderOffline(markdownFile)
 	if err != nil {
-		return fmt.Errorf("转换为Confluence格式失败: %w", err)
+		return "", err
 	}
 	
-	// 2. 再处理图片（此时页面ID已确定）
-	pageID := c.currentPageID
-	if pageID == "" {
-		pageID = parentPageID
+	c.imageHandler.SetDryRun(true)
+	defer c.imageHandler.SetDryRun(false)
+	return c.imageHandler.ProcessImages(htmlContent, markdownDir, "")
+}
+
+// PreviewFile 离线生成Markdown文件的独立HTML预览
+// 参数:
+//   - markdownFile: Markdown文件路径
+//   - title: 预览标题
+// 返回:
+//   - string: HTML内容
+//   - error: 转换失败时的错误
+func (c *Converter) PreviewFile(markdownFile, title string) (string, error) {
+	htmlContent, markdownDir, err := c.renderOffline(markdownFile)
+	if err != nil {
+		return "", err
 	}
-	
-	// 处理图片引用并上传图片
-	contentWithImages, err := c.imageHandler.ProcessImages(htmlContent, markdownDir, pageID)
+	return renderPreview(htmlContent, title, markdownDir, c.out)
+}
+
+// renderOffline 读取并转换Markdown文件，提及的用户不查询Confluence
+// 参数:
+//   - markdownFile: Markdown文件路径
+// 返回:
+//   - string: 存储格式内容（图片处理之前）
+//   - string: Markdown文件所在目录
+//   - error: 转换或校验失败时的错误
+func (c *Converter) renderOffline(markdownFile string) (string, string, error) {
+	content, markdownDir, err := c.readMarkdownFile(markdownFile)
 	if err != nil {
-		return fmt.Errorf("处理图片失败: %w", err)
+		return "", "", err
 	}
 	
-	// 3. 更新或创建页面
-	if existingPage != nil {
-		// 更新现有页面
-		fmt.Printf("📝 正在更新页面: %s...\n", title)
-		err = c.confluenceClient.UpdatePage(
-			existingPage.ID,
-			title,
-			contentWithImages,
-			c.config.Confluence.Space,
-		)
-		if err != nil {
-			return fmt.Errorf("更新页面失败: %w", err)
-		}
-		fmt.Printf("✅ 页面更新成功: %s\n", title)
-		fmt.Printf("🔗 页面链接: %s/pages/viewpage.action?pageId=%s\n", c.config.Confluence.URL, existingPage.ID)
-	} else {
-		// 创建新页面
-		fmt.Printf("📝 正在父页面 %s 下创建新页面: %s...\n", parentPageID, title)
-		newPage, err := c.confluenceClient.CreatePage(
-			title,
-			contentWithImages,
-			parentPageID,
-		)
-		if err != nil {
-			return fmt.Errorf("创建页面失败: %w", err)
-		}
-		c.currentPageID = newPage.ID
-		fmt.Printf("✅ 页面创建成功: %s\n", title)
-		fmt.Printf("🔗 页面链接: %s/pages/viewpage.action?pageId=%s\n", c.config.Confluence.URL, newPage.ID)
+	htmlContent, err := c.Render(content)
+	if err != nil {
+		return "", "", err
 	}
-	
-	return nil
+	return htmlContent, markdownDir, nil
 }
 
 // PublishContent 将Markdown内容转换并发布到Confluence
@@ -137,9 +173,19 @@ func (c *Converter) Publish(markdownFile, title, parentPageID string) error {
 // 返回:
 //   - error: 处理过程中的错误
 func (c *Converter) PublishContent(content, title, parentPageID string) error {
-	// 预处理内容
-	processedContent := c.preprocessor.Process(content)
-	
+	// 对于内容字符串，使用空的markdownDir
+	return c.publish(content, "", title, parentPageID)
+}
+
+// publish 转换、校验并发布Markdown内容
+// 参数:
+//   - content: Markdown内容
+//   - markdownDir: 解析相对图片路径的目录
+//   - title: 页面标题
+//   - parentPageID: 父页面ID
+// 返回:
+//   - error: 处理过程中的错误
+func (c *Converter) publish(content, markdownDir, title, parentPageID string) error {
 	// 如果命令行未指定父页面ID，使用配置中的值
 	if parentPageID == "" && c.config.Confluence.ParentPageID != "" {
 		parentPageID = c.config.Confluence.ParentPageID
@@ -150,41 +196,64 @@ func (c *Converter) PublishContent(content, title, parentPageID string) error {
 		return fmt.Errorf("必须指定父页面ID")
 	}
 	
-	// 在父页面中查找现有页面
-	existingPage, err := c.confluenceClient.FindPageInParent(title, parentPageID)
+	// 1. 先转换文本为Confluence格式，并在任何网络请求之前校验
+	htmlContent, err := c.Render(content)
 	if err != nil {
-		fmt.Printf("⚠️ 警告: 查找现有页面时出错: %s\n", err)
+		return err
 	}
 	
-	// 如果页面已存在，记录其ID
-	if existingPage != nil {
-		c.currentPageID = existingPage.ID
+	// 校验通过后查询提及的用户
+	htmlContent, err = c.contentHandler.ResolveMentions(htmlContent)
+	if err != nil {
+		return fmt.Errorf("处理提及失败: %w", err)
 	}
 	
-	// 1. 先转换文本为Confluence格式
-	htmlContent, err := c.contentHandler.ConvertToConfluence(processedContent)
+	// 在父页面中查找现有页面
+	existingPage, err := c.confluenceClient.FindPageInParent(title, parentPageID)
 	if err != nil {
-		return fmt.Errorf("转换为Confluence格式失败: %w", err)
+		fmt.Fprintf(c.out, "⚠️ 警告: 查找现有页面时出错: %s\n", err)
 	}
 	
-	// 2. 再处理图片（此时页面ID已确定）
-	pageID := c.currentPageID
-	if pageID == "" {
-		pageID = parentPageID
+	// 2. 新页面先创建，附件上传到页面自身而不是父页面
+	// 创建时图片已按附件名引用，上传完成后即可显示；附件名与创建时不同时再更新正文
+	var pageID, draft string
+	if existingPage != nil {
+		pageID = existingPage.ID
+	} else {
+		c.imageHandler.SetDryRun(true)
+		draft, err = c.imageHandler.ProcessImages(htmlContent, markdownDir, "")
+		c.imageHandler.SetDryRun(false)
+		if err != nil {
+			return fmt.Errorf("处理图片失败: %w", err)
+		}
+		if err := ValidateStorage(draft, content); err != nil {
+			return fmt.Errorf("处理图片后的页面内容无效: %w", err)
+		}
+		
+		fmt.Fprintf(c.out, "📝 正在父页面 %s 下创建新页面: %s...\n", parentPageID, title)
+		newPage, err := c.confluenceClient.CreatePage(title, draft, parentPageID)
+		if err != nil {
+			return fmt.Errorf("创建页面失败: %w", err)
+		}
+		pageID = newPage.ID
+		fmt.Fprintf(c.out, "✅ 页面创建成功: %s\n", title)
 	}
+	c.currentPageID = pageID
 	
-	// 处理图片引用并上传图片（对于内容字符串，使用空的markdownDir）
-	contentWithImages, err := c.imageHandler.ProcessImages(htmlContent, "", pageID)
+	// 3. 处理图片引用并上传到页面
+	contentWithImages, err := c.imageHandler.ProcessImages(htmlContent, markdownDir, pageID)
 	if err != nil {
 		return fmt.Errorf("处理图片失败: %w", err)
 	}
+	if err := ValidateStorage(contentWithImages, content); err != nil {
+		return fmt.Errorf("处理图片后的页面内容无效: %w", err)
+	}
 	
-	// 3. 更新或创建页面
-	if existingPage != nil {
-		// 更新现有页面
-		fmt.Printf("📝 正在更新页面: %s...\n", title)
+	// 4. 更新页面正文
+	if existingPage != nil || contentWithImages != draft {
+		fmt.Fprintf(c.out, "📝 正在更新页面: %s...\n", title)
 		err = c.confluenceClient.UpdatePage(
-			existingPage.ID,
+			pageID,
 			title,
 			contentWithImages,
 			c.config.Confluence.Space,
@@ -192,23 +261,64 @@ func (c *Converter) PublishContent(content, title, parentPageID string) error {
 		if err != nil {
 			return fmt.Errorf("更新页面失败: %w", err)
 		}
-		fmt.Printf("✅ 页面更新成功: %s\n", title)
-		fmt.Printf("🔗 页面链接: %s/pages/viewpage.action?pageId=%s\n", c.config.Confluence.URL, existingPage.ID)
-	} else {
-		// 创建新页面
-		fmt.Printf("📝 正在父页面 %s 下创建新页面: %s...\n", parentPageID, title)
-		newPage, err := c.confluenceClient.CreatePage(
-			title,
-			contentWithImages,
-			parentPageID,
-		)
-		if err != nil {
-			return fmt.Errorf("创建页面失败: %w", err)
+		fmt.Fprintf(c.out, "✅ 页面更新成功: %s\n", title)
+	}
+	
+	// 5. 添加标签（Obsidian兼容模式下的 #标签），失败不影响发布
+	if labels := c.contentHandler.Labels(); len(labels) > 0 {
+		if err := c.confluenceClient.AddLabels(pageID, labels); err != nil {
+			fmt.Fprintf(c.out, "⚠️ 警告: 添加标签失败: %v\n", err)
+		} else {
+			fmt.Fprintf(c.out, "🏷️ 已添加标签: %s\n", strings.Join(labels, ", "))
 		}
-		c.currentPageID = newPage.ID
-		fmt.Printf("✅ 页面创建成功: %s\n", title)
-		fmt.Printf("🔗 页面链接: %s/pages/viewpage.action?pageId=%s\n", c.config.Confluence.URL, newPage.ID)
 	}
+	fmt.Fprintf(c.out, "🔗 页面链接: %s/pages/viewpage.action?pageId=%s\n", c.config.Confluence.URL, pageID)
 	
 	return nil
-} 
\ No newline at end of file
+}
+
+// Render 将Markdown内容转换为经过校验的Confluence存储格式（图片尚未处理），不进行任何网络请求
+// 参数:
+//   - content: Markdown内容（可包含front matter）
+// 返回:
+//   - string: 存储格式内容
+//   - error: 转换或校验失败时的错误
+func (c *Converter) Render(content string) (string, error) {
+	processedContent, err := c.prepareContent(content)
+	if err != nil {
+		return "", err
+	}
+	
+	htmlContent, err := c.contentHandler.ConvertToConfluence(processedContent)
+	if err != nil {
+		return "", fmt.Errorf("转换为Confluence格式失败: %w", err)
+	}
+	
+	if err := ValidateStorage(htmlContent, content); err != nil {
+		return "", fmt.Errorf("生成的Confluence存储格式无效: %w", err)
+	}
+	return htmlContent, nil
+}
+
+// prepareContent 解析front matter、替换模板变量并执行预处理
+// 参数:
+//   - content: Markdown内容
+// 返回:
+//   - string: 预处理后的内容
+//   - error: 存在未定义变量（严格模式）时的错误
+func (c *Converter) prepareContent(content string) (string, error) {
+	frontMatter := c.preprocessor.ParseFrontMatter(content)
+	c.contentHandler.SetFrontMatter(frontMatter)
+
+	template := c.config.Markdown.Template
+	expanded, err := c.preprocessor.ExpandVariables(content, c.preprocessor.TemplateVars(template, frontMatter), template)
+	if err != nil {
+		return "", fmt.Errorf("替换模板变量失败: %w", err)
+	}
+
+	processed, err := c.preprocessor.Run(expanded)
+	if err != nil {
+		return "", fmt.Errorf("预处理失败: %w", err)
+	}
+	return processed, nil
+}
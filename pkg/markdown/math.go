@@ -0,0 +1,236 @@
+package markdown
+
+import (
+	"bytes"
+
+	"github.com/HelloAnner/markdown-sync-confluence/pkg/config"
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/parser"
+	"github.com/yuin/goldmark/renderer"
+	"github.com/yuin/goldmark/text"
+	"github.com/yuin/goldmark/util"
+)
+
+// kindMathInline 行内公式节点类型
+var kindMathInline = ast.NewNodeKind("MathInline")
+
+// kindMathBlock 块级公式节点类型
+var kindMathBlock = ast.NewNodeKind("MathBlock")
+
+// mathInline 行内公式 $...$
+type mathInline struct {
+	ast.BaseInline
+	formula []byte
+}
+
+// Kind 实现 ast.Node
+func (n *mathInline) Kind() ast.NodeKind { return kindMathInline }
+
+// Dump 实现 ast.Node
+func (n *mathInline) Dump(source []byte, level int) {
+	ast.DumpHelper(n, source, level, map[string]string{"Formula": string(n.formula)}, nil)
+}
+
+// mathBlock 块级公式 $$...$$
+type mathBlock struct {
+	ast.BaseBlock
+	closed bool // $$...$$ 独占一行时在打开时即已结束
+}
+
+// Kind 实现 ast.Node
+func (n *mathBlock) Kind() ast.NodeKind { return kindMathBlock }
+
+// IsRaw 实现 ast.Node，公式内容不再做Markdown解析
+func (n *mathBlock) IsRaw() bool { return true }
+
+// Dump 实现 ast.Node
+func (n *mathBlock) Dump(source []byte, level int) {
+	ast.DumpHelper(n, source, level, nil, nil)
+}
+
+// mathExtension 为Goldmark添加LaTeX公式支持，并直接渲染为Confluence公式宏
+type mathExtension struct {
+	config config.MathConfig
+}
+
+// Extend 实现 goldmark.Extender
+func (e *mathExtension) Extend(m goldmark.Markdown) {
+	m.Parser().AddOptions(
+		parser.WithBlockParsers(util.Prioritized(&mathBlockParser{}, 650)),
+		parser.WithInlineParsers(util.Prioritized(&mathInlineParser{}, 150)),
+	)
+	m.Renderer().AddOptions(
+		renderer.WithNodeRenderers(util.Prioritized(&mathRenderer{config: e.config.Resolved()}, 150)),
+	)
+}
+
+// mathInlineParser 解析行内公式
+// 规则与Pandoc一致：开头的$后不能是空白，结尾的$前不能是空白且后面不能紧跟数字，
+// 以避免把 "$5 and $10" 之类的金额误判为公式
+type mathInlineParser struct{}
+
+// Trigger 实现 parser.InlineParser
+func (p *mathInlineParser) Trigger() []byte {
+	return []byte{'$'}
+}
+
+// Parse 实现 parser.InlineParser
+func (p *mathInlineParser) Parse(parent ast.Node, block text.Reader, pc parser.Context) ast.Node {
+	line, _ := block.PeekLine()
+
+	// $$...$$ 出现在行内时同样作为行内公式
+	if bytes.HasPrefix(line, []byte("$$")) {
+		end := bytes.Index(line[2:], []byte("$$"))
+		if end <= 0 {
+			return nil
+		}
+		formula := bytes.TrimSpace(line[2 : 2+end])
+		if len(formula) == 0 {
+			return nil
+		}
+		block.Advance(2 + end + 2)
+		return &mathInline{formula: formula}
+	}
+
+	if len(line) < 3 || isMathSpace(line[1]) || line[1] == '$' {
+		return nil
+	}
+
+	for i := 2; i < len(line); i++ {
+		if line[i] != '$' || line[i-1] == '\\' || isMathSpace(line[i-1]) {
+			continue
+		}
+		if i+1 < len(line) && line[i+1] >= '0' && line[i+1] <= '9' {
+			continue
+		}
+		block.Advance(i + 1)
+		return &mathInline{formula: line[1:i]}
+	}
+
+	return nil
+}
+
+// isMathSpace 判断是否为空白字符
+func isMathSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r'
+}
+
+// mathBlockParser 解析块级公式，$$ 单独成行或 $$...$$ 独占一行
+type mathBlockParser struct{}
+
+// Trigger 实现 parser.BlockParser
+func (p *mathBlockParser) Trigger() []byte {
+	return []byte{'$'}
+}
+
+// Open 实现 parser.BlockParser
+func (p *mathBlockParser) Open(parent ast.Node, reader text.Reader, pc parser.Context) (ast.Node, parser.State) {
+	line, segment := reader.PeekLine()
+	pos := pc.BlockOffset()
+	if pos < 0 || !bytes.HasPrefix(line[pos:], []byte("$$")) {
+		return nil, parser.NoChildren
+	}
+
+	node := &mathBlock{}
+	rest := util.TrimRightSpace(line[pos+2:])
+	start := segment.Start + pos + 2
+
+	if len(rest) > 0 {
+		closing := bytes.Index(rest, []byte("$$"))
+		switch {
+		case closing == len(rest)-2:
+			// $$...$$ 独占一行
+			if closing > 0 {
+				node.Lines().Append(text.NewSegment(start, start+closing))
+			}
+			node.closed = true
+			reader.Advance(segment.Len() - 1)
+			return node, parser.NoChildren
+		case closing >= 0:
+			// $$...$$ 之后还有文本，交给行内解析
+			return nil, parser.NoChildren
+		default:
+			node.Lines().Append(text.NewSegment(start, start+len(rest)))
+		}
+	}
+
+	reader.Advance(segment.Len() - 1)
+	return node, parser.NoChildren
+}
+
+// Continue 实现 parser.BlockParser
+func (p *mathBlockParser) Continue(node ast.Node, reader text.Reader, pc parser.Context) parser.State {
+	line, segment := reader.PeekLine()
+	if line == nil || node.(*mathBlock).closed {
+		return parser.Close
+	}
+
+	trimmed := util.TrimRightSpace(line)
+	if bytes.HasSuffix(trimmed, []byte("$$")) {
+		if content := len(trimmed) - 2; len(bytes.TrimSpace(trimmed[:content])) > 0 {
+			node.Lines().Append(text.NewSegment(segment.Start, segment.Start+content))
+		}
+		reader.Advance(segment.Len() - 1)
+		return parser.Close
+	}
+
+	node.Lines().Append(segment)
+	reader.Advance(segment.Len() - 1)
+	return parser.Continue | parser.NoChildren
+}
+
+// Close 实现 parser.BlockParser
+func (p *mathBlockParser) Close(node ast.Node, reader text.Reader, pc parser.Context) {}
+
+// CanInterruptParagraph 实现 parser.BlockParser
+func (p *mathBlockParser) CanInterruptParagraph() bool {
+	return true
+}
+
+// CanAcceptIndentedLine 实现 parser.BlockParser
+func (p *mathBlockParser) CanAcceptIndentedLine() bool {
+	return false
+}
+
+// mathRenderer 将公式节点渲染为Confluence公式宏
+type mathRenderer struct {
+	config config.MathConfig
+}
+
+// RegisterFuncs 实现 renderer.NodeRenderer
+func (r *mathRenderer) RegisterFuncs(reg renderer.NodeRendererFuncRegisterer) {
+	reg.Register(kindMathInline, r.renderMathInline)
+	reg.Register(kindMathBlock, r.renderMathBlock)
+}
+
+func (r *mathRenderer) renderMathInline(w util.BufWriter, source []byte, node ast.Node, entering bool) (ast.WalkStatus, error) {
+	if !entering {
+		return ast.WalkContinue, nil
+	}
+
+	formula := string(node.(*mathInline).formula)
+	if r.config.InlineAsBody {
+		_, _ = w.WriteString(buildMacro(r.config.InlineMacro, nil, plainTextBody(formula)))
+	} else {
+		_, _ = w.WriteString(buildMacro(r.config.InlineMacro, map[string]string{r.config.InlineParameter: formula}, ""))
+	}
+	return ast.WalkSkipChildren, nil
+}
+
+func (r *mathRenderer) renderMathBlock(w util.BufWriter, source []byte, node ast.Node, entering bool) (ast.WalkStatus, error) {
+	if !entering {
+		return ast.WalkContinue, nil
+	}
+
+	var formula bytes.Buffer
+	lines := node.Lines()
+	for i := 0; i < lines.Len(); i++ {
+		line := lines.At(i)
+		formula.Write(line.Value(source))
+	}
+
+	_, _ = w.WriteString(buildMacro(r.config.BlockMacro, nil, plainTextBody(string(bytes.TrimSpace(formula.Bytes())))))
+	_ = w.WriteByte('\n')
+	return ast.WalkSkipChildren, nil
+}
@@ -0,0 +1,224 @@
+package markdown
+
+import (
+	"bytes"
+	"fmt"
+	"html"
+	"io"
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/HelloAnner/markdown-sync-confluence/pkg/config"
+	"github.com/HelloAnner/markdown-sync-confluence/pkg/confluence"
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/parser"
+	"github.com/yuin/goldmark/renderer"
+	"github.com/yuin/goldmark/text"
+	"github.com/yuin/goldmark/util"
+)
+
+// UserResolver 将提及中的用户名（或用户 key、account ID）解析为Confluence用户，
+// 用户不存在时返回 nil
+type UserResolver func(name string) (*confluence.User, error)
+
+// userDirectory 缓存提及用户的解析结果
+type userDirectory struct {
+	out     io.Writer
+	config  config.MentionsConfig
+	resolve UserResolver
+	users   map[string]*confluence.User
+}
+
+// mentionLinkPattern 转换生成的按用户名引用的提及
+var mentionLinkPattern = regexp.MustCompile(`<ac:link><ri:user ri:username="([^"]*)"/></ac:link>`)
+
+// resolveMentions 查询提及的用户，将按用户名的引用改写为 account ID 或用户 key 引用，
+// 未找到的用户还原为提及文本；未设置解析器时保持按用户名引用
+// 参数:
+//   - content: 存储格式内容
+// 返回:
+//   - string: 处理后的内容
+//   - error: 查询用户失败时的错误
+func (d *userDirectory) resolveMentions(content string) (string, error) {
+	if d.resolve == nil {
+		return content, nil
+	}
+
+	var resolveErr error
+	content = replaceOutsideCDATA(content, func(part string) string {
+		return mentionLinkPattern.ReplaceAllStringFunc(part, func(match string) string {
+			if resolveErr != nil {
+				return match
+			}
+			name := html.UnescapeString(mentionLinkPattern.FindStringSubmatch(match)[1])
+			user, err := d.lookup(name)
+			if err != nil {
+				resolveErr = fmt.Errorf("解析用户 %s 失败: %w", name, err)
+				return match
+			}
+			return mentionLink(user, d.config.Prefix+name+d.config.Suffix)
+		})
+	})
+	return content, resolveErr
+}
+
+// lookup 解析用户，结果按名称缓存
+// 返回:
+//   - *confluence.User: 用户信息，不存在时为nil
+//   - error: 查询失败时的错误
+func (d *userDirectory) lookup(name string) (*confluence.User, error) {
+	if user, ok := d.users[name]; ok {
+		return user, nil
+	}
+
+	user, err := d.resolve(name)
+	if err != nil {
+		return nil, err
+	}
+	if user == nil {
+		fmt.Fprintf(d.out, "⚠️ 警告: 未找到用户 %s，保留为文本\n", name)
+	}
+	d.users[name] = user
+	return user, nil
+}
+
+// mentionLink 生成引用用户的链接，用户不存在时为提及文本
+// 参数:
+//   - user: 用户信息
+//   - text: 提及的原始文本
+// 返回:
+//   - string: ri:user 链接或转义后的文本
+func mentionLink(user *confluence.User, text string) string {
+	switch {
+	case user == nil:
+		return html.EscapeString(text)
+	case user.AccountID != "":
+		return `<ac:link><ri:user ri:account-id="` + escapeXMLAttributeValue(user.AccountID) + `"/></ac:link>`
+	case user.UserKey != "":
+		return `<ac:link><ri:user ri:userkey="` + escapeXMLAttributeValue(user.UserKey) + `"/></ac:link>`
+	default:
+		return `<ac:link><ri:user ri:username="` + escapeXMLAttributeValue(user.Username) + `"/></ac:link>`
+	}
+}
+
+// kindMention 提及节点类型
+var kindMention = ast.NewNodeKind("Mention")
+
+// mention 用户提及 @username
+type mention struct {
+	ast.BaseInline
+	name string
+}
+
+// Kind 实现 ast.Node
+func (n *mention) Kind() ast.NodeKind { return kindMention }
+
+// Dump 实现 ast.Node
+func (n *mention) Dump(source []byte, level int) {
+	ast.DumpHelper(n, source, level, map[string]string{"Name": n.name}, nil)
+}
+
+// mentionExtension 将 @username 渲染为Confluence用户链接
+type mentionExtension struct {
+	config config.MentionsConfig
+}
+
+// Extend 实现 goldmark.Extender
+func (e *mentionExtension) Extend(m goldmark.Markdown) {
+	m.Parser().AddOptions(
+		parser.WithInlineParsers(util.Prioritized(&mentionParser{config: e.config}, 200)),
+	)
+	m.Renderer().AddOptions(
+		renderer.WithNodeRenderers(util.Prioritized(&mentionRenderer{config: e.config}, 200)),
+	)
+}
+
+// mentionParser 解析提及语法
+// 未配置后缀时用户名由字母、数字和 . _ - 组成；前缀前紧跟字母或数字时（如邮箱）不视为提及
+type mentionParser struct {
+	config config.MentionsConfig
+}
+
+// Trigger 实现 parser.InlineParser
+func (p *mentionParser) Trigger() []byte {
+	return []byte{p.config.Prefix[0]}
+}
+
+// Parse 实现 parser.InlineParser
+func (p *mentionParser) Parse(parent ast.Node, block text.Reader, pc parser.Context) ast.Node {
+	line, _ := block.PeekLine()
+	if !bytes.HasPrefix(line, []byte(p.config.Prefix)) {
+		return nil
+	}
+	if prev := block.PrecendingCharacter(); unicode.IsLetter(prev) || unicode.IsDigit(prev) {
+		return nil
+	}
+	if inFoldPlaceholder(block, pc) {
+		return nil
+	}
+	rest := line[len(p.config.Prefix):]
+	var name string
+	var length int
+	if p.config.Suffix != "" {
+		end := bytes.Index(rest, []byte(p.config.Suffix))
+		if end <= 0 {
+			return nil
+		}
+		name = strings.TrimSpace(string(rest[:end]))
+		length = end + len(p.config.Suffix)
+	} else {
+		for length < len(rest) {
+			r, size := utf8.DecodeRune(rest[length:])
+			if !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '.' && r != '_' && r != '-' {
+				break
+			}
+			length += size
+		}
+		name = strings.TrimRight(string(rest[:length]), ".-")
+		length = len(name)
+	}
+	if name == "" {
+		return nil
+	}
+
+	block.Advance(len(p.config.Prefix) + length)
+	return &mention{name: name}
+}
+
+// mentionRenderer 将提及节点渲染为按用户名引用的 ri:user 链接，
+// 发布时再由 ContentHandler.ResolveMentions 查询用户
+type mentionRenderer struct {
+	config config.MentionsConfig
+}
+
+// RegisterFuncs 实现 renderer.NodeRenderer
+func (r *mentionRenderer) RegisterFuncs(reg renderer.NodeRendererFuncRegisterer) {
+	reg.Register(kindMention, r.renderMention)
+}
+
+func (r *mentionRenderer) renderMention(w util.BufWriter, source []byte, node ast.Node, entering bool) (ast.WalkStatus, error) {
+	if !entering {
+		return ast.WalkSkipChildren, nil
+	}
+
+	name := node.(*mention).name
+	var user *confluence.User
+	if !insideLink(node) {
+		user = &confluence.User{Username: name}
+	}
+	_, _ = w.WriteString(mentionLink(user, r.config.Prefix+name+r.config.Suffix))
+	return ast.WalkSkipChildren, nil
+}
+
+// insideLink 判断节点是否位于链接文本中，链接中的提及保持为文本
+func insideLink(node ast.Node) bool {
+	for n := node.Parent(); n != nil; n = n.Parent() {
+		if n.Kind() == ast.KindLink || n.Kind() == ast.KindAutoLink {
+			return true
+		}
+	}
+	return false
+}
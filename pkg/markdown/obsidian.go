@@ -0,0 +1,366 @@
+package markdown
+
+import (
+	"bytes"
+	"fmt"
+	"html"
+	"path"
+	"regexp"
+	"strings"
+	"unicode"
+
+	"github.com/HelloAnner/markdown-sync-confluence/pkg/confluence"
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/parser"
+	"github.com/yuin/goldmark/renderer"
+	"github.com/yuin/goldmark/text"
+	"github.com/yuin/goldmark/util"
+)
+
+var (
+	// obsidianCommentPattern %%注释%%（可跨行）；行内代码原样保留
+	obsidianCommentPattern = regexp.MustCompile("(?s)(`[^`\n]*`)|%%.*?%%")
+	// obsidianTagPattern #标签，前面须为行首或空白
+	obsidianTagPattern = regexp.MustCompile(`(?:^|\s)#([\p{L}\p{N}_/-]+)`)
+	// inlineCodeOrTagPattern 查找标签时跳过的行内代码与HTML标签
+	inlineCodeOrTagPattern = regexp.MustCompile("`[^`\n]*`|<[^>\n]+>")
+	// calloutPattern callout的首行：[!类型]、可折叠标记与标题
+	calloutPattern = regexp.MustCompile(`^\[!([A-Za-z-]+)\]([+-]?)[ \t]*(.*?)\s*$`)
+)
+
+// calloutMacros Obsidian callout类型对应的Confluence面板宏，未列出的类型使用info
+var calloutMacros = map[string]string{
+	"tip": "tip", "hint": "tip", "important": "tip", "success": "tip", "check": "tip", "done": "tip",
+	"question": "note", "help": "note", "faq": "note", "warning": "note", "caution": "note", "attention": "note",
+	"failure": "warning", "fail": "warning", "missing": "warning", "danger": "warning", "error": "warning", "bug": "warning",
+}
+
+// preProcessObsidian 去除 %%注释%% 并收集 #标签（围栏代码块与行内代码中的内容不处理）
+// 参数:
+//   - content: Markdown内容
+// 返回:
+//   - string: 去除注释后的内容
+func (ch *ContentHandler) preProcessObsidian(content string) string {
+	lines := strings.Split(content, "\n")
+	inCode := codeFenceMask(lines)
+
+	// 连续的非代码行作为一段处理，注释可以跨行
+	var result, segment []string
+	flush := func() {
+		if len(segment) == 0 {
+			return
+		}
+		text := obsidianCommentPattern.ReplaceAllStringFunc(strings.Join(segment, "\n"), func(match string) string {
+			if strings.HasPrefix(match, "`") {
+				return match
+			}
+			return ""
+		})
+		result = append(result, text)
+		segment = nil
+	}
+	for i, line := range lines {
+		if inCode[i] {
+			flush()
+			result = append(result, line)
+			continue
+		}
+		segment = append(segment, line)
+	}
+	flush()
+	content = strings.Join(result, "\n")
+
+	// 收集标签：front matter 中的 tags 与正文中的 #标签
+	seen := make(map[string]bool)
+	var labels []string
+	addLabel := func(tag string) {
+		if label := obsidianLabel(tag); label != "" && !seen[label] {
+			seen[label] = true
+			labels = append(labels, label)
+		}
+	}
+	switch tags := ch.frontMatter["tags"].(type) {
+	case []interface{}:
+		for _, tag := range tags {
+			addLabel(fmt.Sprint(tag))
+		}
+	case string:
+		for _, tag := range strings.FieldsFunc(tags, func(r rune) bool { return r == ',' || unicode.IsSpace(r) }) {
+			addLabel(tag)
+		}
+	}
+	lines = strings.Split(content, "\n")
+	inCode = codeFenceMask(lines)
+	for i, line := range lines {
+		if inCode[i] {
+			continue
+		}
+		for _, match := range obsidianTagPattern.FindAllStringSubmatch(inlineCodeOrTagPattern.ReplaceAllString(line, " "), -1) {
+			addLabel(match[1])
+		}
+	}
+	ch.labels = labels
+
+	return content
+}
+
+// obsidianLabel 将标签转换为Confluence标签名：小写，嵌套标签的 / 替换为 -，纯数字的标签无效
+func obsidianLabel(tag string) string {
+	tag = strings.ToLower(strings.Trim(strings.TrimPrefix(strings.TrimSpace(tag), "#"), "/-"))
+	if strings.IndexFunc(tag, func(r rune) bool { return !unicode.IsDigit(r) }) < 0 {
+		return ""
+	}
+	return strings.ReplaceAll(tag, "/", "-")
+}
+
+// Labels 返回最近一次转换的文档的标签（Obsidian兼容模式下收集）
+// 返回:
+//   - []string: 标签列表
+func (ch *ContentHandler) Labels() []string {
+	return ch.labels
+}
+
+// kindWikiLink 笔记链接节点类型
+var kindWikiLink = ast.NewNodeKind("WikiLink")
+
+// wikiLink 指向其他笔记（页面）的链接 [[笔记#标题|别名]]
+type wikiLink struct {
+	ast.BaseInline
+	page    string // 页面标题，为空时指向当前页面
+	heading string
+	alias   string
+}
+
+// Kind 实现 ast.Node
+func (n *wikiLink) Kind() ast.NodeKind { return kindWikiLink }
+
+// Dump 实现 ast.Node
+func (n *wikiLink) Dump(source []byte, level int) {
+	ast.DumpHelper(n, source, level, map[string]string{"Page": n.page, "Heading": n.heading, "Alias": n.alias}, nil)
+}
+
+// kindCallout callout节点类型
+var kindCallout = ast.NewNodeKind("Callout")
+
+// callout Obsidian callout，由首行为 [!类型] 的引用块转换而来
+type callout struct {
+	ast.BaseBlock
+	calloutType string
+	title       string
+	foldable    bool
+}
+
+// Kind 实现 ast.Node
+func (n *callout) Kind() ast.NodeKind { return kindCallout }
+
+// Dump 实现 ast.Node
+func (n *callout) Dump(source []byte, level int) {
+	ast.DumpHelper(n, source, level, map[string]string{"Type": n.calloutType, "Title": n.title}, nil)
+}
+
+// obsidianExtension 将笔记链接渲染为页面链接，将callout渲染为面板或折叠宏
+type obsidianExtension struct{}
+
+// Extend 实现 goldmark.Extender
+func (e *obsidianExtension) Extend(m goldmark.Markdown) {
+	// [[笔记]] 需先于链接解析器处理 [
+	m.Parser().AddOptions(
+		parser.WithInlineParsers(util.Prioritized(&wikiLinkParser{}, 199)),
+		parser.WithASTTransformers(util.Prioritized(&calloutTransformer{}, 100)),
+	)
+	m.Renderer().AddOptions(
+		renderer.WithNodeRenderers(util.Prioritized(&obsidianRenderer{}, 200)),
+	)
+}
+
+// wikiLinkParser 解析 [[笔记]]、[[笔记|别名]]、[[笔记#标题]] 与 [[#标题]]
+// ![[...]] 嵌入由图片处理与文件包含负责
+type wikiLinkParser struct{}
+
+// Trigger 实现 parser.InlineParser
+func (p *wikiLinkParser) Trigger() []byte {
+	return []byte{'['}
+}
+
+// Parse 实现 parser.InlineParser
+func (p *wikiLinkParser) Parse(parent ast.Node, block text.Reader, pc parser.Context) ast.Node {
+	if pc.IsInLinkLabel() || block.PrecendingCharacter() == '!' {
+		return nil
+	}
+	line, _ := block.PeekLine()
+	if !bytes.HasPrefix(line, []byte("[[")) || bytes.HasPrefix(line, []byte("[[jira:")) {
+		return nil
+	}
+	end := bytes.Index(line, []byte("]]"))
+	if end < 0 {
+		return nil
+	}
+	inner := string(line[2:end])
+	if strings.ContainsAny(inner, "[]\n") {
+		return nil
+	}
+
+	// 表格单元格中以 \| 书写分隔符
+	target, alias, _ := strings.Cut(inner, "|")
+	target = strings.TrimSuffix(target, "\\")
+	page, heading, _ := strings.Cut(target, "#")
+	page = strings.TrimSpace(page)
+	if page != "" {
+		page = path.Base(strings.TrimSuffix(strings.TrimSuffix(page, ".md"), ".markdown"))
+	}
+	// 多级标题只保留最后一级；块引用 ^id 无法对应到Confluence锚点
+	if idx := strings.LastIndex(heading, "#"); idx >= 0 {
+		heading = heading[idx+1:]
+	}
+	heading = strings.TrimSpace(heading)
+	if strings.HasPrefix(heading, "^") {
+		heading = ""
+	}
+	if page == "" && heading == "" {
+		return nil
+	}
+
+	block.Advance(end + 2)
+	return &wikiLink{page: page, heading: heading, alias: strings.TrimSpace(alias)}
+}
+
+// calloutTransformer 将首行为 [!类型] 的引用块转换为callout
+type calloutTransformer struct{}
+
+// Transform 实现 parser.ASTTransformer
+func (t *calloutTransformer) Transform(doc *ast.Document, reader text.Reader, pc parser.Context) {
+	var quotes []*ast.Blockquote
+	_ = ast.Walk(doc, func(n ast.Node, entering bool) (ast.WalkStatus, error) {
+		if quote, ok := n.(*ast.Blockquote); ok && entering {
+			quotes = append(quotes, quote)
+		}
+		return ast.WalkContinue, nil
+	})
+
+	// 由内向外转换，嵌套的callout先于外层处理
+	for i := len(quotes) - 1; i >= 0; i-- {
+		convertCallout(quotes[i], reader.Source())
+	}
+}
+
+// convertCallout 将引用块转换为callout，首行不是 [!类型] 时保持不变
+// 参数:
+//   - quote: 引用块
+//   - source: Markdown源文本
+func convertCallout(quote *ast.Blockquote, source []byte) {
+	paragraph, ok := quote.FirstChild().(*ast.Paragraph)
+	if !ok || paragraph.Lines().Len() == 0 {
+		return
+	}
+	first := paragraph.Lines().At(0)
+	m := calloutPattern.FindStringSubmatch(string(first.Value(source)))
+	if m == nil {
+		return
+	}
+
+	node := &callout{calloutType: strings.ToLower(m[1]), title: m[3], foldable: m[2] != ""}
+
+	// 去掉首行：只有一行时整段移除，否则移除首行的行内节点
+	if paragraph.Lines().Len() == 1 {
+		quote.RemoveChild(quote, paragraph)
+	} else {
+		for child := paragraph.FirstChild(); child != nil; {
+			next := child.NextSibling()
+			paragraph.RemoveChild(paragraph, child)
+			if t, ok := child.(*ast.Text); ok && (t.SoftLineBreak() || t.HardLineBreak() || t.Segment.Stop >= first.Stop) {
+				break
+			}
+			child = next
+		}
+		lines := paragraph.Lines()
+		lines.SetSliced(1, lines.Len())
+	}
+
+	for child := quote.FirstChild(); child != nil; {
+		next := child.NextSibling()
+		node.AppendChild(node, child)
+		child = next
+	}
+	quote.Parent().ReplaceChild(quote.Parent(), quote, node)
+}
+
+// obsidianRenderer 渲染笔记链接与callout
+type obsidianRenderer struct{}
+
+// RegisterFuncs 实现 renderer.NodeRenderer
+func (r *obsidianRenderer) RegisterFuncs(reg renderer.NodeRendererFuncRegisterer) {
+	reg.Register(kindWikiLink, r.renderWikiLink)
+	reg.Register(kindCallout, r.renderCallout)
+}
+
+func (r *obsidianRenderer) renderWikiLink(w util.BufWriter, source []byte, node ast.Node, entering bool) (ast.WalkStatus, error) {
+	if !entering {
+		return ast.WalkSkipChildren, nil
+	}
+
+	n := node.(*wikiLink)
+	body := n.alias
+	if body == "" {
+		switch {
+		case n.page == "":
+			body = n.heading
+		case n.heading == "":
+			body = n.page
+		default:
+			body = n.page + " > " + n.heading
+		}
+	}
+	anchor := ""
+	if n.heading != "" {
+		anchor = confluence.HeadingAnchor(n.heading)
+	}
+
+	if n.page == "" {
+		_, _ = w.WriteString(anchorLink(anchor, html.EscapeString(body)))
+		return ast.WalkSkipChildren, nil
+	}
+	_, _ = w.WriteString(`<ac:link`)
+	if anchor != "" {
+		_, _ = w.WriteString(` ac:anchor="` + escapeXMLAttributeValue(anchor) + `"`)
+	}
+	_, _ = w.WriteString(`><ri:page ri:content-title="` + escapeXMLAttributeValue(n.page) + `"/>` +
+		linkBody(html.EscapeString(body)) + `</ac:link>`)
+	return ast.WalkSkipChildren, nil
+}
+
+func (r *obsidianRenderer) renderCallout(w util.BufWriter, source []byte, node ast.Node, entering bool) (ast.WalkStatus, error) {
+	if !entering {
+		_, _ = w.WriteString("</ac:rich-text-body></ac:structured-macro>\n")
+		return ast.WalkContinue, nil
+	}
+
+	// 可折叠的callout使用折叠宏，其余使用对应的面板宏
+	n := node.(*callout)
+	name, params := calloutMacros[n.calloutType], map[string]string{}
+	if name == "" {
+		name = "info"
+	}
+	if n.title != "" {
+		params["title"] = n.title
+	}
+	if n.foldable {
+		name = "expand"
+		if n.title == "" {
+			params["title"] = calloutTitle(n.calloutType)
+		}
+	}
+	_, _ = w.WriteString(strings.TrimSuffix(buildMacro(name, params, "<ac:rich-text-body>"), "</ac:structured-macro>"))
+	return ast.WalkContinue, nil
+}
+
+// calloutTitle 返回未指定标题时的默认标题（首字母大写的类型名）
+func calloutTitle(calloutType string) string {
+	words := strings.Split(calloutType, "-")
+	for i, word := range words {
+		if word != "" {
+			words[i] = strings.ToUpper(word[:1]) + word[1:]
+		}
+	}
+	return strings.Join(words, " ")
+}
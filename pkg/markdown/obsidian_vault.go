@@ -0,0 +1,99 @@
+package markdown
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// obsidianVault Obsidian仓库中文件的索引，用于按文件名查找 ![[name]] 引用的文件
+type obsidianVault struct {
+	root  string
+	files map[string][]string // 键为小写的文件名，值为文件的绝对路径
+}
+
+// findVaultRoot 确定Obsidian仓库根目录
+// 参数:
+//   - configured: 配置的仓库根目录，为空时自动查找
+//   - dir: Markdown文件所在目录
+// 返回:
+//   - string: 向上查找到的包含 .obsidian 的目录，找不到时为Markdown文件所在目录
+func findVaultRoot(configured, dir string) string {
+	if configured != "" {
+		if abs, err := filepath.Abs(configured); err == nil {
+			return abs
+		}
+		return configured
+	}
+
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return dir
+	}
+	for current := abs; ; {
+		if info, err := os.Stat(filepath.Join(current, ".obsidian")); err == nil && info.IsDir() {
+			return current
+		}
+		parent := filepath.Dir(current)
+		if parent == current {
+			return abs
+		}
+		current = parent
+	}
+}
+
+// loadObsidianVault 建立仓库中文件的索引，跳过以 . 开头的目录（如 .obsidian、.git）
+// 参数:
+//   - root: 仓库根目录
+// 返回:
+//   - *obsidianVault: 仓库索引
+func loadObsidianVault(root string) *obsidianVault {
+	vault := &obsidianVault{root: root, files: make(map[string][]string)}
+	_ = filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		if d.IsDir() {
+			if path != root && strings.HasPrefix(d.Name(), ".") {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		name := strings.ToLower(d.Name())
+		vault.files[name] = append(vault.files[name], path)
+		return nil
+	})
+
+	// 同名文件按路径由短到长排列，与Obsidian优先使用最近的文件一致
+	for _, paths := range vault.files {
+		sort.Slice(paths, func(i, j int) bool {
+			if len(paths[i]) != len(paths[j]) {
+				return len(paths[i]) < len(paths[j])
+			}
+			return paths[i] < paths[j]
+		})
+	}
+	return vault
+}
+
+// resolve 按文件名（可带部分路径，如 images/a.png）查找仓库中的文件
+// 参数:
+//   - name: 引用的文件名
+// 返回:
+//   - string: 文件的绝对路径
+//   - bool: 是否找到
+func (v *obsidianVault) resolve(name string) (string, bool) {
+	name = strings.Trim(filepath.ToSlash(name), "/")
+	if name == "" {
+		return "", false
+	}
+	suffix := "/" + strings.ToLower(name)
+	for _, path := range v.files[strings.ToLower(filepath.Base(name))] {
+		if strings.HasSuffix(strings.ToLower(filepath.ToSlash(path)), suffix) {
+			return path, true
+		}
+	}
+	return "", false
+}
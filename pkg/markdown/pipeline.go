@@ -0,0 +1,165 @@
+package markdown
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/HelloAnner/markdown-sync-confluence/pkg/config"
+)
+
+// StagePhase 转换阶段所处理的内容类型
+type StagePhase int
+
+const (
+	// StageMarkdown 处理Markdown源文本（渲染之前）
+	StageMarkdown StagePhase = iota
+	// StageStorage 处理Confluence存储格式XHTML（渲染之后）
+	StageStorage
+)
+
+// String 返回阶段名称
+func (p StagePhase) String() string {
+	if p == StageStorage {
+		return "storage"
+	}
+	return "markdown"
+}
+
+// Stage 是转换流水线中的一个步骤
+type Stage interface {
+	// Name 返回步骤名称，用于排序、覆盖和通过配置禁用
+	Name() string
+	// Process 处理内容并返回结果
+	Process(content string) (string, error)
+}
+
+// funcStage 以函数实现的步骤
+type funcStage struct {
+	name string
+	fn   func(content string) (string, error)
+}
+
+func (s funcStage) Name() string                           { return s.name }
+func (s funcStage) Process(content string) (string, error) { return s.fn(content) }
+
+// NewStage 使用函数创建一个步骤
+// 参数:
+//   - name: 步骤名称
+//   - fn: 处理函数
+// 返回:
+//   - Stage: 步骤实例
+func NewStage(name string, fn func(content string) (string, error)) Stage {
+	return funcStage{name: name, fn: fn}
+}
+
+// textStage 将不会失败的处理函数包装为步骤
+func textStage(name string, fn func(content string) string) Stage {
+	return NewStage(name, func(content string) (string, error) {
+		return fn(content), nil
+	})
+}
+
+// registeredStage 已注册的步骤
+type registeredStage struct {
+	phase StagePhase
+	order int
+	seq   int // 注册顺序，order 相同时保持注册顺序
+	stage Stage
+}
+
+// Pipeline 按顺序执行的转换步骤集合
+// 内置步骤的 order 以 100 为间隔，自定义步骤可插入其间；同一阶段注册同名步骤会替换原步骤
+type Pipeline struct {
+	stages []registeredStage
+	config config.PipelineConfig
+	seq    int
+}
+
+// NewPipeline 创建一个空的流水线
+// 返回:
+//   - *Pipeline: 流水线实例
+func NewPipeline() *Pipeline {
+	return &Pipeline{}
+}
+
+// Register 注册步骤
+// 参数:
+//   - phase: 步骤所处的阶段
+//   - order: 执行顺序，数值小的先执行
+//   - stage: 步骤
+func (p *Pipeline) Register(phase StagePhase, order int, stage Stage) {
+	p.seq++
+	registered := registeredStage{phase: phase, order: order, seq: p.seq, stage: stage}
+	for i, existing := range p.stages {
+		if existing.phase == phase && existing.stage.Name() == stage.Name() {
+			p.stages[i] = registered
+			return
+		}
+	}
+	p.stages = append(p.stages, registered)
+}
+
+// Configure 应用配置中的禁用列表与顺序覆盖
+// 参数:
+//   - cfg: 流水线配置
+func (p *Pipeline) Configure(cfg config.PipelineConfig) {
+	p.config = cfg
+}
+
+// Stages 返回某一阶段将要执行的步骤名称（已排除禁用的步骤）
+// 参数:
+//   - phase: 阶段
+// 返回:
+//   - []string: 按执行顺序排列的步骤名称
+func (p *Pipeline) Stages(phase StagePhase) []string {
+	var names []string
+	for _, registered := range p.ordered(phase) {
+		names = append(names, registered.stage.Name())
+	}
+	return names
+}
+
+// Run 依次执行某一阶段的步骤
+// 参数:
+//   - phase: 阶段
+//   - content: 输入内容
+// 返回:
+//   - string: 处理后的内容
+//   - error: 步骤返回的错误
+func (p *Pipeline) Run(phase StagePhase, content string) (string, error) {
+	for _, registered := range p.ordered(phase) {
+		var err error
+		content, err = registered.stage.Process(content)
+		if err != nil {
+			return "", fmt.Errorf("%s 阶段步骤 %s 失败: %w", phase, registered.stage.Name(), err)
+		}
+	}
+	return content, nil
+}
+
+// ordered 返回某一阶段启用的步骤，按 order 排序
+func (p *Pipeline) ordered(phase StagePhase) []registeredStage {
+	disabled := make(map[string]bool)
+	for _, name := range p.config.Disabled {
+		disabled[name] = true
+	}
+
+	var stages []registeredStage
+	for _, registered := range p.stages {
+		if registered.phase != phase || disabled[registered.stage.Name()] {
+			continue
+		}
+		if order, ok := p.config.Order[registered.stage.Name()]; ok {
+			registered.order = order
+		}
+		stages = append(stages, registered)
+	}
+
+	sort.Slice(stages, func(i, j int) bool {
+		if stages[i].order != stages[j].order {
+			return stages[i].order < stages[j].order
+		}
+		return stages[i].seq < stages[j].seq
+	})
+	return stages
+}
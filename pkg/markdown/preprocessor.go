@@ -1,23 +1,68 @@
 package markdown
 
 import (
+	"fmt"
+	"io"
+	"os"
 	"regexp"
 	"strings"
+
+	"github.com/HelloAnner/markdown-sync-confluence/pkg/config"
+	"gopkg.in/yaml.v3"
 )
 
 // Preprocessor handles front matter and other pre-processing steps
-type Preprocessor struct{}
+type Preprocessor struct {
+	pipeline *Pipeline
+	vault    *config.ObsidianConfig // set when ![[note]] may be resolved anywhere in an Obsidian vault
+	out      io.Writer              // receives warnings
+}
 
-// NewPreprocessor creates a new preprocessor
+// NewPreprocessor creates a new preprocessor with the built-in stages registered
 func NewPreprocessor() *Preprocessor {
-	return &Preprocessor{}
+	p := &Preprocessor{pipeline: NewPipeline(), out: os.Stdout}
+	p.pipeline.Register(StageMarkdown, 100, textStage("front-matter", p.StripFrontMatter))
+	p.pipeline.Register(StageMarkdown, 200, textStage("url-escape", p.PreprocessURLs))
+	return p
+}
+
+// Pipeline returns the preprocessing pipeline. Its stages see the raw source,
+// before front matter is removed.
+func (p *Preprocessor) Pipeline() *Pipeline {
+	return p.pipeline
+}
+
+// SetOutput sets where warnings are written (os.Stdout by default)
+func (p *Preprocessor) SetOutput(w io.Writer) {
+	p.out = w
 }
 
-// Process applies all preprocessing steps to the markdown content
+// SetObsidian enables vault-wide lookup of ![[note]] transclusions that are not
+// found next to the including file
+func (p *Preprocessor) SetObsidian(cfg config.ObsidianConfig) {
+	if cfg.Enabled {
+		p.vault = &cfg
+	} else {
+		p.vault = nil
+	}
+}
+
+// Process applies all preprocessing stages to the markdown content. If a custom
+// stage fails, the failure is reported and only the built-in steps are applied;
+// use Run to handle the error instead.
 func (p *Preprocessor) Process(content string) string {
-    content = p.StripFrontMatter(content)
-    content = p.PreprocessURLs(content)
-    return content
+	processed, err := p.Run(content)
+	if err != nil {
+		fmt.Fprintf(p.out, "⚠️ 警告: 预处理失败，仅执行内置步骤: %v\n", err)
+		return p.PreprocessURLs(p.StripFrontMatter(content))
+	}
+	return processed
+}
+
+// Run applies all preprocessing stages to the markdown content and returns the
+// first stage error
+func (p *Preprocessor) Run(content string) (string, error) {
+	return p.pipeline.Run(StageMarkdown, content)
 }
 
 // StripFrontMatter removes YAML front matter from Markdown content
@@ -29,44 +74,67 @@ func (p *Preprocessor) StripFrontMatter(content string) string {
         normalized = strings.TrimPrefix(normalized, "\uFEFF")
     }
 
-    // Allow optional leading blank lines before frontmatter
     lines := strings.Split(normalized, "\n")
-    start := 0
-    for start < len(lines) && strings.TrimSpace(lines[start]) == "" {
-        start++
-    }
-
-    // Frontmatter must start with a line that is exactly '---'
-    if start < len(lines) && strings.TrimSpace(lines[start]) == "---" {
-        // Find the closing '---' or '...' line
-        end := start + 1
-        for end < len(lines) {
-            trimmed := strings.TrimSpace(lines[end])
-            if trimmed == "---" || trimmed == "..." {
-                break
-            }
-            end++
+    if _, end, ok := locateFrontMatter(lines); ok {
+        // Skip the closing line
+        next := end + 1
+        // Optionally skip a single blank line after frontmatter
+        if next < len(lines) && strings.TrimSpace(lines[next]) == "" {
+            next++
         }
-
-        if end < len(lines) { // Found a terminator
-            // Skip the closing line
-            next := end + 1
-            // Optionally skip a single blank line after frontmatter
-            if next < len(lines) && strings.TrimSpace(lines[next]) == "" {
-                next++
-            }
-            result := strings.Join(lines[next:], "\n")
-            // Keep original line endings if they were CRLF in the input
-            if strings.Contains(content, "\r\n") {
-                return strings.ReplaceAll(result, "\n", "\r\n")
-            }
-            return result
+        result := strings.Join(lines[next:], "\n")
+        // Keep original line endings if they were CRLF in the input
+        if strings.Contains(content, "\r\n") {
+            return strings.ReplaceAll(result, "\n", "\r\n")
         }
+        return result
     }
 
     return content
 }
 
+// ParseFrontMatter returns the YAML front matter of Markdown content as a map.
+// Missing or malformed front matter yields an empty map.
+func (p *Preprocessor) ParseFrontMatter(content string) map[string]interface{} {
+	frontMatter := make(map[string]interface{})
+
+	normalized := strings.TrimPrefix(strings.ReplaceAll(content, "\r\n", "\n"), "\uFEFF")
+	lines := strings.Split(normalized, "\n")
+	start, end, ok := locateFrontMatter(lines)
+	if !ok {
+		return frontMatter
+	}
+
+	if err := yaml.Unmarshal([]byte(strings.Join(lines[start+1:end], "\n")), &frontMatter); err != nil || frontMatter == nil {
+		return make(map[string]interface{})
+	}
+	return frontMatter
+}
+
+// locateFrontMatter finds the opening and closing delimiter lines of front matter
+func locateFrontMatter(lines []string) (int, int, bool) {
+	// Allow optional leading blank lines before frontmatter
+	start := 0
+	for start < len(lines) && strings.TrimSpace(lines[start]) == "" {
+		start++
+	}
+
+	// Frontmatter must start with a line that is exactly '---'
+	if start >= len(lines) || strings.TrimSpace(lines[start]) != "---" {
+		return 0, 0, false
+	}
+
+	// Find the closing '---' or '...' line
+	for end := start + 1; end < len(lines); end++ {
+		trimmed := strings.TrimSpace(lines[end])
+		if trimmed == "---" || trimmed == "..." {
+			return start, end, true
+		}
+	}
+
+	return 0, 0, false
+}
+
 // PreprocessURLs encodes special characters in URLs
 func (p *Preprocessor) PreprocessURLs(content string) string {
 	// Find Markdown links and encode & in URLs
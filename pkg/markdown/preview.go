@@ -0,0 +1,522 @@
+package markdown
+
+import (
+	"encoding/base64"
+	"encoding/xml"
+	"fmt"
+	"html"
+	"io"
+	"mime"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/HelloAnner/markdown-sync-confluence/pkg/confluence"
+)
+
+// previewNode 存储格式解析后的节点
+type previewNode struct {
+	name     string // 元素名（带 ac:/ri: 前缀），文本节点为空
+	attrs    map[string]string
+	attrList []xml.Attr
+	children []*previewNode
+	text     string
+}
+
+// attr 返回属性值
+func (n *previewNode) attr(name string) string {
+	return n.attrs[name]
+}
+
+// child 返回第一个指定名称的子元素
+func (n *previewNode) child(name string) *previewNode {
+	for _, c := range n.children {
+		if c.name == name {
+			return c
+		}
+	}
+	return nil
+}
+
+// textContent 返回节点的全部文本
+func (n *previewNode) textContent() string {
+	if n.name == "" {
+		return n.text
+	}
+	var sb strings.Builder
+	for _, c := range n.children {
+		sb.WriteString(c.textContent())
+	}
+	return sb.String()
+}
+
+// previewRenderer 将存储格式渲染为HTML预览
+type previewRenderer struct {
+	markdownDir string
+	headings    []previewHeading
+	out         strings.Builder
+	messages    io.Writer // 警告信息的输出
+}
+
+// previewHeading 目录中的标题
+type previewHeading struct {
+	level int
+	text  string
+	id    string
+}
+
+// previewEmoticons Confluence表情对应的字符
+var previewEmoticons = map[string]string{
+	"smile": "🙂", "sad": "🙁", "cheeky": "😛", "laugh": "😆", "wink": "😉",
+	"thumbs-up": "👍", "thumbs-down": "👎", "information": "ℹ️", "tick": "✅", "cross": "❌",
+	"warning": "⚠️", "plus": "➕", "minus": "➖", "question": "❓", "light-on": "💡",
+	"light-off": "🌑", "yellow-star": "⭐", "red-star": "⭐", "green-star": "⭐", "blue-star": "⭐",
+	"heart": "❤️", "broken-heart": "💔",
+}
+
+// previewVoidElements 自闭合的HTML元素
+var previewVoidElements = map[string]bool{"br": true, "hr": true, "img": true, "col": true}
+
+// RenderPreview 将存储格式渲染为独立的HTML预览（近似效果）
+// 宏渲染为带样式的区块，代码块做简单的语法高亮，本地图片以data URI内联
+// 参数:
+//   - storage: 存储格式内容（图片处理之前）
+//   - title: 页面标题
+//   - markdownDir: 解析相对图片路径的目录
+// 返回:
+//   - string: HTML文档
+//   - error: 解析存储格式失败时的错误
+func RenderPreview(storage, title, markdownDir string) (string, error) {
+	return renderPreview(storage, title, markdownDir, os.Stdout)
+}
+
+// renderPreview 渲染HTML预览，警告信息写入 messages
+func renderPreview(storage, title, markdownDir string, messages io.Writer) (string, error) {
+	root, err := parsePreviewTree(storage)
+	if err != nil {
+		return "", err
+	}
+
+	r := &previewRenderer{markdownDir: markdownDir, messages: messages}
+	r.collectHeadings(root)
+	r.renderChildren(root)
+
+	return fmt.Sprintf(previewTemplate, html.EscapeString(title), previewStyle, html.EscapeString(title), r.out.String()), nil
+}
+
+// parsePreviewTree 将存储格式解析为节点树
+func parsePreviewTree(storage string) (*previewNode, error) {
+	decoder := xml.NewDecoder(strings.NewReader(storageRootOpen + storage + storageRootClose))
+	decoder.Strict = true
+	decoder.Entity = xml.HTMLEntity
+
+	root := &previewNode{name: "root"}
+	stack := []*previewNode{root}
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("解析存储格式失败: %w", err)
+		}
+
+		parent := stack[len(stack)-1]
+		switch t := token.(type) {
+		case xml.StartElement:
+			node := &previewNode{name: qualifiedName(t.Name), attrs: make(map[string]string)}
+			for _, attr := range t.Attr {
+				if attr.Name.Space == "xmlns" {
+					continue
+				}
+				node.attrs[qualifiedName(attr.Name)] = attr.Value
+				node.attrList = append(node.attrList, attr)
+			}
+			parent.children = append(parent.children, node)
+			stack = append(stack, node)
+		case xml.EndElement:
+			stack = stack[:len(stack)-1]
+		case xml.CharData:
+			parent.children = append(parent.children, &previewNode{text: string(t)})
+		}
+	}
+
+	// 去掉包裹用的根元素
+	if len(root.children) == 1 && root.children[0].name == "ac:confluence" {
+		return root.children[0], nil
+	}
+	return root, nil
+}
+
+// collectHeadings 收集标题用于渲染目录
+func (r *previewRenderer) collectHeadings(n *previewNode) {
+	if len(n.name) == 2 && n.name[0] == 'h' && n.name[1] >= '1' && n.name[1] <= '6' {
+		text := strings.TrimSpace(n.textContent())
+		r.headings = append(r.headings, previewHeading{level: int(n.name[1] - '0'), text: text, id: previewAnchorID(text)})
+	}
+	for _, c := range n.children {
+		r.collectHeadings(c)
+	}
+}
+
+// renderChildren 渲染所有子节点
+func (r *previewRenderer) renderChildren(n *previewNode) {
+	for _, c := range n.children {
+		r.render(c)
+	}
+}
+
+// render 渲染单个节点
+func (r *previewRenderer) render(n *previewNode) {
+	switch {
+	case n.name == "":
+		r.out.WriteString(html.EscapeString(n.text))
+	case n.name == "ac:structured-macro":
+		r.renderMacro(n)
+	case n.name == "ac:emoticon":
+		if emoji, ok := previewEmoticons[n.attr("ac:name")]; ok {
+			r.out.WriteString(emoji)
+		} else {
+			r.out.WriteString(":" + html.EscapeString(n.attr("ac:name")) + ":")
+		}
+	case n.name == "ac:link":
+		r.renderLink(n)
+	case n.name == "ac:image":
+		r.renderImage(n)
+	case n.name == "ac:task-list":
+		r.out.WriteString(`<ul class="task-list">`)
+		for _, task := range n.children {
+			if task.name != "ac:task" {
+				continue
+			}
+			checked := ""
+			if status := task.child("ac:task-status"); status != nil && strings.TrimSpace(status.textContent()) == "complete" {
+				checked = " checked"
+			}
+			r.out.WriteString(`<li><input type="checkbox" disabled` + checked + `/> `)
+			if body := task.child("ac:task-body"); body != nil {
+				r.renderChildren(body)
+			}
+			r.out.WriteString(`</li>`)
+		}
+		r.out.WriteString(`</ul>`)
+	case n.name == "img":
+		r.out.WriteString(`<img src="` + html.EscapeString(r.imageSource(n.attr("src"))) + `" alt="` + html.EscapeString(n.attr("alt")) + `"/>`)
+	case strings.HasPrefix(n.name, "ac:") || strings.HasPrefix(n.name, "ri:"):
+		// 其他Confluence元素只渲染内容
+		r.renderChildren(n)
+	default:
+		r.renderElement(n)
+	}
+}
+
+// renderElement 原样渲染HTML元素，标题补充锚点id
+func (r *previewRenderer) renderElement(n *previewNode) {
+	r.out.WriteString("<" + n.name)
+	for _, attr := range n.attrList {
+		r.out.WriteString(" " + qualifiedName(attr.Name) + `="` + html.EscapeString(attr.Value) + `"`)
+	}
+	if len(n.name) == 2 && n.name[0] == 'h' && n.attrs["id"] == "" {
+		r.out.WriteString(` id="` + html.EscapeString(previewAnchorID(n.textContent())) + `"`)
+	}
+	if previewVoidElements[n.name] {
+		r.out.WriteString("/>")
+		return
+	}
+	r.out.WriteString(">")
+	r.renderChildren(n)
+	r.out.WriteString("</" + n.name + ">")
+}
+
+// macroParameters 返回宏的参数
+func macroParameters(n *previewNode) map[string]string {
+	params := make(map[string]string)
+	for _, c := range n.children {
+		if c.name == "ac:parameter" {
+			params[c.attr("ac:name")] = c.textContent()
+		}
+	}
+	return params
+}
+
+// renderMacro 将宏渲染为带样式的区块
+func (r *previewRenderer) renderMacro(n *previewNode) {
+	name := n.attr("ac:name")
+	params := macroParameters(n)
+	plainBody := ""
+	if body := n.child("ac:plain-text-body"); body != nil {
+		plainBody = body.textContent()
+	}
+	richBody := n.child("ac:rich-text-body")
+
+	switch name {
+	case "code":
+		r.out.WriteString(`<div class="macro code">`)
+		if title := params["title"]; title != "" {
+			r.out.WriteString(`<div class="code-title">` + html.EscapeString(title) + `</div>`)
+		}
+		r.out.WriteString(`<pre><code>` + highlightCode(plainBody, params["language"]) + `</code></pre></div>`)
+	case "info", "note", "warning", "tip", "panel":
+		r.out.WriteString(`<div class="macro panel ` + name + `">`)
+		if title := params["title"]; title != "" {
+			r.out.WriteString(`<div class="panel-title">` + html.EscapeString(title) + `</div>`)
+		}
+		if richBody != nil {
+			r.renderChildren(richBody)
+		}
+		r.out.WriteString(`</div>`)
+	case "expand":
+		title := params["title"]
+		if title == "" {
+			title = "点击展开"
+		}
+		r.out.WriteString(`<details class="macro expand"><summary>` + html.EscapeString(title) + `</summary>`)
+		if richBody != nil {
+			r.renderChildren(richBody)
+		}
+		r.out.WriteString(`</details>`)
+	case "status":
+		colour := strings.ToLower(params["colour"])
+		if colour == "" {
+			colour = "grey"
+		}
+		class := "status " + colour
+		if params["subtle"] == "true" {
+			class += " subtle"
+		}
+		r.out.WriteString(`<span class="` + html.EscapeString(class) + `">` + html.EscapeString(params["title"]) + `</span>`)
+	case "anchor":
+		r.out.WriteString(`<a id="` + html.EscapeString(params[""]) + `"></a>`)
+	case "toc":
+		r.renderTOC(params)
+	case "jira":
+		r.out.WriteString(`<span class="jira">` + html.EscapeString(params["key"]) + `</span>`)
+	case "mathinline":
+		formula := plainBody
+		if formula == "" {
+			formula = params["body"]
+		}
+		r.out.WriteString(`<code class="math">` + html.EscapeString(formula) + `</code>`)
+	case "mathblock":
+		r.out.WriteString(`<pre class="math">` + html.EscapeString(plainBody) + `</pre>`)
+	default:
+		r.out.WriteString(`<div class="macro unknown"><div class="macro-name">` + html.EscapeString(name) + `</div>`)
+		if richBody != nil {
+			r.renderChildren(richBody)
+		} else if plainBody != "" {
+			r.out.WriteString(`<pre>` + html.EscapeString(plainBody) + `</pre>`)
+		}
+		r.out.WriteString(`</div>`)
+	}
+}
+
+// renderTOC 根据收集到的标题渲染目录
+func (r *previewRenderer) renderTOC(params map[string]string) {
+	minLevel, maxLevel := 1, 6
+	fmt.Sscan(params["minLevel"], &minLevel)
+	fmt.Sscan(params["maxLevel"], &maxLevel)
+
+	r.out.WriteString(`<nav class="macro toc"><ul>`)
+	for _, h := range r.headings {
+		if h.level < minLevel || h.level > maxLevel {
+			continue
+		}
+		r.out.WriteString(fmt.Sprintf(`<li style="margin-left: %dem"><a href="#%s">%s</a></li>`,
+			h.level-minLevel, html.EscapeString(h.id), html.EscapeString(h.text)))
+	}
+	r.out.WriteString(`</ul></nav>`)
+}
+
+// renderLink 渲染页内锚点、用户与附件链接
+func (r *previewRenderer) renderLink(n *previewNode) {
+	body := n.child("ac:link-body")
+	plain := n.child("ac:plain-text-link-body")
+	writeBody := func(fallback string) {
+		switch {
+		case body != nil:
+			r.renderChildren(body)
+		case plain != nil:
+			r.out.WriteString(html.EscapeString(plain.textContent()))
+		default:
+			r.out.WriteString(html.EscapeString(fallback))
+		}
+	}
+
+	switch {
+	case n.child("ri:user") != nil:
+		user := n.child("ri:user")
+		name := user.attr("ri:username") + user.attr("ri:userkey") + user.attr("ri:account-id")
+		r.out.WriteString(`<span class="mention">@` + html.EscapeString(name) + `</span>`)
+	case n.child("ri:attachment") != nil:
+		filename := n.child("ri:attachment").attr("ri:filename")
+		r.out.WriteString(`<a href="` + html.EscapeString(filename) + `">`)
+		writeBody(filename)
+		r.out.WriteString(`</a>`)
+	case n.child("ri:page") != nil:
+		page := n.child("ri:page").attr("ri:content-title")
+		r.out.WriteString(`<a href="#">`)
+		writeBody(page)
+		r.out.WriteString(`</a>`)
+	default:
+		anchor := n.attr("ac:anchor")
+		r.out.WriteString(`<a href="#` + html.EscapeString(anchor) + `">`)
+		writeBody(anchor)
+		r.out.WriteString(`</a>`)
+	}
+}
+
+// renderImage 渲染 ac:image
+func (r *previewRenderer) renderImage(n *previewNode) {
+	src := ""
+	if url := n.child("ri:url"); url != nil {
+		src = url.attr("ri:value")
+	} else if attachment := n.child("ri:attachment"); attachment != nil {
+		src = r.imageSource(attachment.attr("ri:filename"))
+	}
+	r.out.WriteString(`<img src="` + html.EscapeString(src) + `" alt="` + html.EscapeString(n.attr("ac:alt")) + `"`)
+	if width := n.attr("ac:width"); width != "" {
+		r.out.WriteString(` width="` + html.EscapeString(width) + `"`)
+	}
+	if height := n.attr("ac:height"); height != "" {
+		r.out.WriteString(` height="` + html.EscapeString(height) + `"`)
+	}
+	if title := n.attr("ac:title"); title != "" {
+		r.out.WriteString(` title="` + html.EscapeString(title) + `"`)
+	}
+	switch n.attr("ac:align") {
+	case "center":
+		r.out.WriteString(` style="display: block; margin: 0 auto;"`)
+	case "left", "right":
+		r.out.WriteString(` style="float: ` + n.attr("ac:align") + `;"`)
+	}
+	r.out.WriteString(`/>`)
+}
+
+// imageSource 将本地图片内联为data URI，远程图片保持原样
+func (r *previewRenderer) imageSource(src string) string {
+	if isRemoteOrAbsolute(src) && !filepath.IsAbs(src) {
+		return src
+	}
+	path := src
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(r.markdownDir, filepath.FromSlash(src))
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		fmt.Fprintf(r.messages, "⚠️ 警告: 预览时无法读取图片 %s: %v\n", path, err)
+		return src
+	}
+	contentType := mime.TypeByExtension(filepath.Ext(path))
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	return "data:" + contentType + ";base64," + base64.StdEncoding.EncodeToString(data)
+}
+
+// previewAnchorID 生成预览中的锚点id，与Confluence的标题锚点一致
+func previewAnchorID(text string) string {
+	return confluence.HeadingAnchor(strings.TrimSpace(text))
+}
+
+var (
+	// 代码高亮规则：注释、字符串、数字、关键字
+	highlightSlashComments = regexp.MustCompile(`(?s)(//[^\n]*|/\*.*?\*/|--[^\n]*)|("(?:\\.|[^"\\\n])*"|'(?:\\.|[^'\\\n])*'|` + "`[^`]*`" + `)|\b(\d+(?:\.\d+)?)\b|\b([A-Za-z_]\w*)\b`)
+	highlightHashComments  = regexp.MustCompile(`(?s)(#[^\n]*)|("(?:\\.|[^"\\\n])*"|'(?:\\.|[^'\\\n])*'|` + "`[^`]*`" + `)|\b(\d+(?:\.\d+)?)\b|\b([A-Za-z_]\w*)\b`)
+	highlightHashLanguages = map[string]bool{"bash": true, "sh": true, "shell": true, "python": true, "ruby": true, "perl": true, "yaml": true, "yml": true, "toml": true, "powershell": true, "r": true, "dockerfile": true, "makefile": true}
+	highlightKeywords      = map[string]bool{}
+)
+
+func init() {
+	for _, keyword := range strings.Fields(`if else for while do switch case default break continue return func function def class struct
+		interface type var let const import from package public private protected static new this self try catch except finally
+		throw raise in of and or not is nil null None true false True False go defer select map chan async await yield with as
+		echo fi then elif done esac SELECT FROM WHERE INSERT UPDATE DELETE JOIN ON AND OR NOT NULL CREATE TABLE`) {
+		highlightKeywords[keyword] = true
+	}
+}
+
+// highlightCode 对代码做简单的语法高亮，输出转义后的HTML
+func highlightCode(code, language string) string {
+	pattern := highlightSlashComments
+	if highlightHashLanguages[strings.ToLower(language)] {
+		pattern = highlightHashComments
+	}
+
+	var sb strings.Builder
+	last := 0
+	for _, m := range pattern.FindAllStringSubmatchIndex(code, -1) {
+		sb.WriteString(html.EscapeString(code[last:m[0]]))
+		token := html.EscapeString(code[m[0]:m[1]])
+		switch {
+		case m[2] >= 0:
+			sb.WriteString(`<span class="hl-comment">` + token + `</span>`)
+		case m[4] >= 0:
+			sb.WriteString(`<span class="hl-string">` + token + `</span>`)
+		case m[6] >= 0:
+			sb.WriteString(`<span class="hl-number">` + token + `</span>`)
+		case highlightKeywords[code[m[0]:m[1]]]:
+			sb.WriteString(`<span class="hl-keyword">` + token + `</span>`)
+		default:
+			sb.WriteString(token)
+		}
+		last = m[1]
+	}
+	sb.WriteString(html.EscapeString(code[last:]))
+	return sb.String()
+}
+
+// previewTemplate 预览页面模板
+const previewTemplate = `<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8"/>
+<title>%s</title>
+<style>%s</style>
+</head>
+<body>
+<h1 class="page-title">%s</h1>
+%s
+</body>
+</html>
+`
+
+// previewStyle 预览页面样式，近似Confluence的显示效果
+const previewStyle = `
+body { font-family: -apple-system, "Segoe UI", Roboto, "PingFang SC", sans-serif; max-width: 960px; margin: 2em auto; padding: 0 1em; color: #172b4d; line-height: 1.6; }
+.page-title { border-bottom: 1px solid #dfe1e6; padding-bottom: .3em; }
+table { border-collapse: collapse; margin: 1em 0; }
+th, td { border: 1px solid #c1c7d0; padding: 6px 10px; }
+th { background: #f4f5f7; }
+img { max-width: 100%; }
+code { background: #f4f5f7; padding: 1px 4px; border-radius: 3px; }
+.macro { margin: 1em 0; border-radius: 3px; }
+.macro.code { border: 1px solid #dfe1e6; }
+.macro.code pre { margin: 0; padding: 10px; background: #f4f5f7; overflow-x: auto; }
+.macro.code code { background: none; padding: 0; }
+.code-title { padding: 4px 10px; border-bottom: 1px solid #dfe1e6; font-weight: bold; }
+.hl-comment { color: #6a737d; font-style: italic; }
+.hl-string { color: #22863a; }
+.hl-number { color: #005cc5; }
+.hl-keyword { color: #d73a49; font-weight: bold; }
+.panel { padding: 10px 14px; border-left: 4px solid; }
+.panel.info { background: #deebff; border-color: #0052cc; }
+.panel.note { background: #eae6ff; border-color: #5243aa; }
+.panel.warning { background: #ffebe6; border-color: #de350b; }
+.panel.tip { background: #e3fcef; border-color: #00875a; }
+.panel.panel { background: #f4f5f7; border-color: #c1c7d0; }
+.panel-title { font-weight: bold; }
+.expand { border: 1px solid #dfe1e6; padding: 6px 10px; }
+.expand summary { cursor: pointer; color: #0052cc; }
+.status { display: inline-block; padding: 0 4px; border-radius: 3px; font-size: 11px; font-weight: bold; text-transform: uppercase; color: #fff; }
+.status.grey { background: #42526e; } .status.red { background: #de350b; } .status.yellow { background: #ff991f; color: #172b4d; }
+.status.green { background: #00875a; } .status.blue { background: #0052cc; } .status.purple { background: #5243aa; }
+.status.subtle { background: #fff; border: 1px solid currentColor; color: #42526e; }
+.toc ul { list-style: none; padding-left: 0; }
+.jira { background: #deebff; padding: 1px 4px; border-radius: 3px; }
+.mention { background: #dfe1e6; padding: 1px 4px; border-radius: 10px; }
+.math { font-family: "Times New Roman", serif; }
+.task-list { list-style: none; padding-left: 0; }
+.unknown { border: 1px dashed #c1c7d0; padding: 6px 10px; }
+.macro-name { font-size: 11px; color: #6b778c; text-transform: uppercase; }
+`
@@ -0,0 +1,39 @@
+package markdown
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRenderPreview(t *testing.T) {
+	dir := t.TempDir()
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "pic.png"), []byte("png"), 0644))
+
+	source := "# Intro\n\n[[toc]]\n\nHello :smile: {status:green|Done} see [intro](#intro).\n\n" +
+		"```go\n// note\nreturn \"x\"\n```\n\n- [x] done\n\n![pic](pic.png)\n"
+	storage, err := NewContentHandler(nil).ConvertToConfluence(source)
+	assert.NoError(t, err)
+
+	preview, err := RenderPreview(storage, "Doc & Notes", dir)
+	assert.NoError(t, err)
+	assert.Contains(t, preview, "<title>Doc &amp; Notes</title>")
+	assert.Contains(t, preview, `<h1 id="Intro">Intro</h1>`)
+	assert.Contains(t, preview, `<nav class="macro toc"><ul><li style="margin-left: 0em"><a href="#Intro">Intro</a></li></ul></nav>`)
+	assert.Contains(t, preview, `Hello 🙂 <span class="status green">Done</span> see <a href="#Intro">intro</a>.`)
+	assert.Contains(t, preview, `<span class="hl-comment">// note</span>`)
+	assert.Contains(t, preview, `<span class="hl-keyword">return</span> <span class="hl-string">&#34;x&#34;</span>`)
+	assert.Contains(t, preview, `<input type="checkbox" disabled checked/> done`)
+	assert.Contains(t, preview, `<img src="data:image/png;base64,cG5n" alt="pic"/>`)
+
+	preview, err = RenderPreview(`<ac:structured-macro ac:name="info"><ac:rich-text-body><p>tip</p></ac:rich-text-body></ac:structured-macro>`+
+		`<ac:structured-macro ac:name="children"></ac:structured-macro>`, "t", "")
+	assert.NoError(t, err)
+	assert.Contains(t, preview, `<div class="macro panel info"><p>tip</p></div>`)
+	assert.Contains(t, preview, `<div class="macro unknown"><div class="macro-name">children</div></div>`)
+
+	_, err = RenderPreview("<p>open", "t", "")
+	assert.Error(t, err)
+}
@@ -0,0 +1,129 @@
+package markdown
+
+import (
+	"bytes"
+	"strings"
+
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/parser"
+	"github.com/yuin/goldmark/renderer"
+	"github.com/yuin/goldmark/text"
+	"github.com/yuin/goldmark/util"
+)
+
+// statusColours 状态宏支持的颜色
+var statusColours = map[string]string{
+	"grey":   "Grey",
+	"gray":   "Grey",
+	"red":    "Red",
+	"yellow": "Yellow",
+	"green":  "Green",
+	"blue":   "Blue",
+	"purple": "Purple",
+}
+
+// kindStatus 状态节点类型
+var kindStatus = ast.NewNodeKind("Status")
+
+// status 状态标签 {status:green|DONE}
+type status struct {
+	ast.BaseInline
+	title  string
+	colour string // 为空时使用Confluence默认的灰色
+	subtle bool
+}
+
+// Kind 实现 ast.Node
+func (n *status) Kind() ast.NodeKind { return kindStatus }
+
+// Dump 实现 ast.Node
+func (n *status) Dump(source []byte, level int) {
+	ast.DumpHelper(n, source, level, map[string]string{"Title": n.title, "Colour": n.colour}, nil)
+}
+
+// statusExtension 将 {status:colour|title} 渲染为Confluence状态宏
+type statusExtension struct{}
+
+// Extend 实现 goldmark.Extender
+func (e *statusExtension) Extend(m goldmark.Markdown) {
+	m.Parser().AddOptions(
+		parser.WithInlineParsers(util.Prioritized(&statusParser{}, 200)),
+	)
+	m.Renderer().AddOptions(
+		renderer.WithNodeRenderers(util.Prioritized(&statusRenderer{}, 200)),
+	)
+}
+
+// statusParser 解析状态标签，语法为 {status|标题}、{status:green|标题} 或 {status:green,subtle|标题}
+type statusParser struct{}
+
+// Trigger 实现 parser.InlineParser
+func (p *statusParser) Trigger() []byte {
+	return []byte{'{'}
+}
+
+// Parse 实现 parser.InlineParser
+func (p *statusParser) Parse(parent ast.Node, block text.Reader, pc parser.Context) ast.Node {
+	line, _ := block.PeekLine()
+	if !bytes.HasPrefix(line, []byte("{status")) {
+		return nil
+	}
+
+	end := bytes.IndexByte(line, '}')
+	if end < 0 {
+		return nil
+	}
+	spec, title, ok := strings.Cut(string(line[len("{status"):end]), "|")
+	title = strings.TrimSpace(title)
+	if !ok || title == "" {
+		return nil
+	}
+	// 表格单元格中以 \| 书写分隔符
+	spec = strings.TrimSuffix(spec, "\\")
+
+	node := &status{title: title}
+	if spec != "" {
+		if spec[0] != ':' {
+			return nil
+		}
+		for _, option := range strings.Split(spec[1:], ",") {
+			option = strings.ToLower(strings.TrimSpace(option))
+			if colour, ok := statusColours[option]; ok {
+				node.colour = colour
+			} else if option == "subtle" {
+				node.subtle = true
+			} else if option != "" {
+				return nil
+			}
+		}
+	}
+
+	block.Advance(end + 1)
+	return node
+}
+
+// statusRenderer 将状态节点渲染为status宏
+type statusRenderer struct{}
+
+// RegisterFuncs 实现 renderer.NodeRenderer
+func (r *statusRenderer) RegisterFuncs(reg renderer.NodeRendererFuncRegisterer) {
+	reg.Register(kindStatus, r.renderStatus)
+}
+
+func (r *statusRenderer) renderStatus(w util.BufWriter, source []byte, node ast.Node, entering bool) (ast.WalkStatus, error) {
+	if !entering {
+		return ast.WalkSkipChildren, nil
+	}
+
+	n := node.(*status)
+	params := map[string]string{"title": n.title}
+	if n.colour != "" {
+		params["colour"] = n.colour
+	}
+	if n.subtle {
+		params["subtle"] = "true"
+	}
+	_, _ = w.WriteString(buildMacro("status", params, ""))
+	return ast.WalkSkipChildren, nil
+}
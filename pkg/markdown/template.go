@@ -0,0 +1,83 @@
+package markdown
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/HelloAnner/markdown-sync-confluence/pkg/config"
+)
+
+// templateVariable matches {{ .Vars.name }} placeholders
+var templateVariable = regexp.MustCompile(`\{\{\s*\.Vars\.([A-Za-z_][A-Za-z0-9_.-]*)\s*\}\}`)
+
+// TemplateVars merges the configured template variables over the `vars` map of
+// the front matter, which only provides document defaults.
+func (p *Preprocessor) TemplateVars(cfg config.TemplateConfig, frontMatter map[string]interface{}) map[string]string {
+	vars := make(map[string]string)
+	if fmVars, ok := frontMatter["vars"].(map[string]interface{}); ok {
+		for name, value := range fmVars {
+			vars[name] = fmt.Sprint(value)
+		}
+	}
+	for name, value := range cfg.Vars {
+		vars[name] = value
+	}
+	return vars
+}
+
+// ExpandVariables replaces {{ .Vars.name }} placeholders with their values.
+// Fenced code blocks and inline code spans are left untouched unless
+// cfg.CodeBlocks is set. Undefined
+// variables are kept as-is with a warning, or reported as an error in strict mode.
+func (p *Preprocessor) ExpandVariables(content string, vars map[string]string, cfg config.TemplateConfig) (string, error) {
+	lines := strings.Split(content, "\n")
+	inCode := codeFenceMask(lines)
+	undefined := make(map[string]bool)
+
+	for i, line := range lines {
+		if inCode[i] && !cfg.CodeBlocks {
+			continue
+		}
+		expand := func(text string) string {
+			return templateVariable.ReplaceAllStringFunc(text, func(match string) string {
+				name := templateVariable.FindStringSubmatch(match)[1]
+				if value, ok := vars[name]; ok {
+					return value
+				}
+				undefined[name] = true
+				return match
+			})
+		}
+		if cfg.CodeBlocks {
+			lines[i] = expand(line)
+			continue
+		}
+
+		var expanded strings.Builder
+		last := 0
+		for _, span := range inlineCodeSpans(line) {
+			expanded.WriteString(expand(line[last:span[0]]))
+			expanded.WriteString(line[span[0]:span[1]])
+			last = span[1]
+		}
+		expanded.WriteString(expand(line[last:]))
+		lines[i] = expanded.String()
+	}
+
+	if len(undefined) > 0 {
+		names := make([]string, 0, len(undefined))
+		for name := range undefined {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		if cfg.Strict {
+			return "", fmt.Errorf("未定义的模板变量: %s", strings.Join(names, ", "))
+		}
+		fmt.Fprintf(p.out, "⚠️ 警告: 未定义的模板变量保持原样: %s\n", strings.Join(names, ", "))
+	}
+
+	return strings.Join(lines, "\n"), nil
+}
@@ -0,0 +1,34 @@
+package markdown
+
+import (
+	"testing"
+
+	"github.com/HelloAnner/markdown-sync-confluence/pkg/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExpandVariables(t *testing.T) {
+	p := NewPreprocessor()
+	content := "---\nvars:\n  host: fm.example.com\n  port: 22\n---\nssh {{ .Vars.host }}:{{.Vars.port}} {{ .Vars.missing }}\n\n```\n{{ .Vars.host }}\n```\n" +
+		"Use `{{ .Vars.host }}` or ``{{ .Vars.port }}`` in templates, not ` {{ .Vars.host }}\n"
+
+	cfg := config.TemplateConfig{Vars: map[string]string{"host": "prod.example.com"}}
+	vars := p.TemplateVars(cfg, p.ParseFrontMatter(content))
+	assert.Equal(t, map[string]string{"host": "prod.example.com", "port": "22"}, vars)
+
+	result, err := p.ExpandVariables(content, vars, cfg)
+	assert.NoError(t, err)
+	assert.Contains(t, result, "ssh prod.example.com:22 {{ .Vars.missing }}\n")
+	assert.Contains(t, result, "```\n{{ .Vars.host }}\n```")
+	assert.Contains(t, result, "Use `{{ .Vars.host }}` or ``{{ .Vars.port }}`` in templates, not ` prod.example.com\n")
+
+	cfg.CodeBlocks = true
+	result, err = p.ExpandVariables(content, vars, cfg)
+	assert.NoError(t, err)
+	assert.Contains(t, result, "```\nprod.example.com\n```")
+	assert.Contains(t, result, "Use `prod.example.com` or ``22``")
+
+	cfg.Strict = true
+	_, err = p.ExpandVariables(content, vars, cfg)
+	assert.EqualError(t, err, "未定义的模板变量: missing")
+}
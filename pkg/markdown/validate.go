@@ -0,0 +1,242 @@
+package markdown
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+// storageRoot 包裹存储格式内容的根元素，声明 ac: / ri: 命名空间
+const (
+	storageRootOpen  = `<ac:confluence xmlns:ac="http://atlassian.com/content" xmlns:ri="http://atlassian.com/resource/identifier" xmlns:at="http://atlassian.com/template">` + "\n"
+	storageRootClose = "\n</ac:confluence>"
+)
+
+// storageParents 已知元素允许的父元素
+var storageParents = map[string][]string{
+	"ac:parameter":            {"ac:structured-macro"},
+	"ac:plain-text-body":      {"ac:structured-macro"},
+	"ac:rich-text-body":       {"ac:structured-macro"},
+	"ac:task":                 {"ac:task-list"},
+	"ac:task-status":          {"ac:task"},
+	"ac:task-body":            {"ac:task"},
+	"ac:task-id":              {"ac:task"},
+	"ac:plain-text-link-body": {"ac:link"},
+	"ac:link-body":            {"ac:link"},
+}
+
+// storageRequiredAttrs 已知元素必需的属性
+var storageRequiredAttrs = map[string]string{
+	"ac:structured-macro": "ac:name",
+	"ac:parameter":        "ac:name",
+	"ac:emoticon":         "ac:name",
+	"ri:attachment":       "ri:filename",
+	"ri:url":              "ri:value",
+}
+
+// placeholderPattern 转换过程中未被替换的内部占位符（折叠块、任务列表、目录）
+var placeholderPattern = regexp.MustCompile(`\b(?:(?:FOLD|TASK)_PLACEHOLDER(?:_TITLE|_STATUS)?|TOC_PLACEHOLDER)\b`)
+
+// literalElements 内容按原样显示的元素，其中的占位符文本是用户内容而非转换遗留
+var literalElements = []string{"ac:plain-text-body", "ac:plain-text-link-body", "code", "pre"}
+
+// ValidationError 存储格式校验错误
+type ValidationError struct {
+	Line         int    // 存储格式中的行号
+	Column       int    // 存储格式中的列号
+	Message      string // 错误描述
+	Context      string // 出错位置所在的存储格式行
+	MarkdownLine int    // 推测的Markdown源文件行号，无法定位时为0
+}
+
+// Error 实现 error
+func (e *ValidationError) Error() string {
+	location := fmt.Sprintf("存储格式第 %d 行第 %d 列", e.Line, e.Column)
+	if e.MarkdownLine > 0 {
+		location += fmt.Sprintf("（约在Markdown第 %d 行）", e.MarkdownLine)
+	}
+	return fmt.Sprintf("%s: %s\n    %s", location, e.Message, e.Context)
+}
+
+// ValidateStorage 以XML解析生成的Confluence存储格式，并检查已知宏的结构
+// 参数:
+//   - storage: 存储格式内容
+//   - source: 对应的Markdown内容，用于推测出错位置（可为空）
+// 返回:
+//   - error: 第一个错误（*ValidationError），内容有效时为nil
+func ValidateStorage(storage, source string) error {
+	decoder := xml.NewDecoder(strings.NewReader(storageRootOpen + storage + storageRootClose))
+	decoder.Strict = true
+	decoder.Entity = xml.HTMLEntity
+
+	// 根元素占用第一行
+	fail := func(message string) error {
+		line, column := decoder.InputPos()
+		return newValidationError(storage, source, line-1, column, message)
+	}
+
+	var stack []string
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			var syntaxErr *xml.SyntaxError
+			if errors.As(err, &syntaxErr) {
+				return fail(strings.ReplaceAll(syntaxErr.Msg, "</confluence>", "文档结尾"))
+			}
+			return fail(err.Error())
+		}
+
+		switch t := token.(type) {
+		case xml.StartElement:
+			name := qualifiedName(t.Name)
+			if attr, ok := storageRequiredAttrs[name]; ok && !hasAttr(t, attr) {
+				return fail(fmt.Sprintf("<%s> 缺少 %s 属性", name, attr))
+			}
+			if parents, ok := storageParents[name]; ok {
+				parent := ""
+				if len(stack) > 0 {
+					parent = stack[len(stack)-1]
+				}
+				if !containsString(parents, parent) {
+					return fail(fmt.Sprintf("<%s> 必须位于 <%s> 中", name, strings.Join(parents, "> 或 <")))
+				}
+			}
+			stack = append(stack, name)
+		case xml.EndElement:
+			stack = stack[:len(stack)-1]
+		case xml.CharData:
+			if insideLiteral(stack) {
+				continue
+			}
+			if m := placeholderPattern.Find(t); m != nil {
+				return fail(fmt.Sprintf("存在未替换的占位符 %s", m))
+			}
+		}
+	}
+
+	return nil
+}
+
+// insideLiteral 判断当前位置是否位于按原样显示的元素（代码宏、<code> 等）中
+func insideLiteral(stack []string) bool {
+	for _, name := range stack {
+		if containsString(literalElements, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// newValidationError 创建校验错误，并尝试定位对应的Markdown行
+func newValidationError(storage, source string, line, column int, message string) *ValidationError {
+	lines := strings.Split(storage, "\n")
+	if line < 1 {
+		line = 1
+	}
+	if line > len(lines) {
+		line = len(lines)
+	}
+
+	context := lines[line-1]
+	return &ValidationError{
+		Line:         line,
+		Column:       column,
+		Message:      message,
+		Context:      truncateContext(context, column),
+		MarkdownLine: locateMarkdownLine(source, lines[:line]),
+	}
+}
+
+// locateMarkdownLine 根据出错位置之前最近的可见文本，在Markdown源中查找对应行
+func locateMarkdownLine(source string, storageLines []string) int {
+	if source == "" {
+		return 0
+	}
+	sourceLines := strings.Split(source, "\n")
+	reTag := regexp.MustCompile(`<[^>]*>|<!\[CDATA\[|\]\]>`)
+
+	for i := len(storageLines) - 1; i >= 0; i-- {
+		for _, fragment := range reTag.Split(storageLines[i], -1) {
+			fragment = strings.TrimSpace(fragment)
+			if len([]rune(fragment)) < 4 {
+				continue
+			}
+			for n, sourceLine := range sourceLines {
+				if strings.Contains(sourceLine, fragment) {
+					return n + 1
+				}
+			}
+		}
+	}
+	return 0
+}
+
+// truncateContext 截取出错列附近的内容，避免输出过长的行
+func truncateContext(line string, column int) string {
+	const radius = 80
+	start := max(column-radius, 0)
+	end := min(column+radius, len(line))
+	if start >= end {
+		return line
+	}
+	// 对齐到字符边界
+	for start > 0 && !utf8.RuneStart(line[start]) {
+		start--
+	}
+	for end < len(line) && !utf8.RuneStart(line[end]) {
+		end++
+	}
+	context := line[start:end]
+	if start > 0 {
+		context = "..." + context
+	}
+	if end < len(line) {
+		context += "..."
+	}
+	return context
+}
+
+// storageNamespaces 命名空间到前缀的映射
+var storageNamespaces = map[string]string{
+	"http://atlassian.com/content":             "ac",
+	"http://atlassian.com/resource/identifier": "ri",
+	"http://atlassian.com/template":            "at",
+}
+
+// qualifiedName 返回带前缀的元素或属性名
+func qualifiedName(name xml.Name) string {
+	if name.Space == "" {
+		return name.Local
+	}
+	if prefix, ok := storageNamespaces[name.Space]; ok {
+		return prefix + ":" + name.Local
+	}
+	return name.Space + ":" + name.Local
+}
+
+// hasAttr 判断元素是否带有指定属性
+func hasAttr(element xml.StartElement, name string) bool {
+	for _, attr := range element.Attr {
+		if qualifiedName(attr.Name) == name {
+			return true
+		}
+	}
+	return false
+}
+
+// containsString 判断切片是否包含指定字符串
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
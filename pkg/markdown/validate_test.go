@@ -0,0 +1,44 @@
+package markdown
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateStorage(t *testing.T) {
+	source := "# Title\n\nSome intro text\n\n- [ ] task\n"
+	result, err := NewContentHandler(nil).ConvertToConfluence(source)
+	assert.NoError(t, err)
+	assert.NoError(t, ValidateStorage(result, source))
+	assert.NoError(t, ValidateStorage(`<p>a&nbsp;b</p><ac:image><ri:attachment ri:filename="a.png"/></ac:image>`, ""))
+
+	err = ValidateStorage("<h1>Title</h1>\n<p>Some intro text</p>\n<p>Tom & Jerry</p>", source)
+	var validationErr *ValidationError
+	assert.ErrorAs(t, err, &validationErr)
+	assert.Equal(t, 3, validationErr.Line)
+	assert.Equal(t, 3, validationErr.MarkdownLine)
+
+	err = ValidateStorage(`<p><ac:parameter ac:name="x">1</ac:parameter></p>`, "")
+	assert.ErrorContains(t, err, "<ac:parameter> 必须位于 <ac:structured-macro> 中")
+
+	err = ValidateStorage(`<ac:structured-macro><ac:parameter ac:name="x">1</ac:parameter></ac:structured-macro>`, "")
+	assert.ErrorContains(t, err, "<ac:structured-macro> 缺少 ac:name 属性")
+
+	err = ValidateStorage("<p>TASK_PLACEHOLDER_STATUS:complete</p>", "")
+	assert.ErrorContains(t, err, "未替换的占位符 TASK_PLACEHOLDER")
+
+	err = ValidateStorage("<p>FOLD_PLACEHOLDER_TITLE:Notes:CONTENT:x:FOLD_PLACEHOLDER</p>", "")
+	assert.ErrorContains(t, err, "未替换的占位符 FOLD_PLACEHOLDER_TITLE")
+
+	// 用户内容中的相似文本以及代码中的占位符不视为错误
+	assert.NoError(t, ValidateStorage("<p>Set MY_PLACEHOLDER and IMAGE_PLACEHOLDER_1</p>", ""))
+	assert.NoError(t, ValidateStorage("<p><code>TOC_PLACEHOLDER</code></p>", ""))
+	source = "```\nTASK_PLACEHOLDER_STATUS\n```\n"
+	result, err = NewContentHandler(nil).ConvertToConfluence(source)
+	assert.NoError(t, err)
+	assert.NoError(t, ValidateStorage(result, source))
+
+	err = ValidateStorage("<p>open", "")
+	assert.ErrorContains(t, err, "文档结尾")
+}